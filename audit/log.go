@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+// Filter selects audit events. Zero fields match any event.
+type Filter struct {
+	Operation  string
+	InstanceId string
+	BindingId  string
+	Outcome    string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+func (f Filter) Matches(event *model.AuditEvent) bool {
+	if f.Operation != "" && event.Operation != f.Operation {
+		return false
+	}
+	if f.InstanceId != "" && event.InstanceId != f.InstanceId {
+		return false
+	}
+	if f.BindingId != "" && event.BindingId != f.BindingId {
+		return false
+	}
+	if f.Outcome != "" && event.Outcome != f.Outcome {
+		return false
+	}
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !event.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Log is the audit trail of the broker.
+type Log struct {
+	sink Sink
+}
+
+func NewLog(sink Sink) *Log {
+	return &Log{sink: sink}
+}
+
+// Record fills in the id and time of event if they are missing, redacts its
+// parameters and appends it to the sink. Failures are logged, an operation
+// that has already been carried out can not be undone for want of an audit
+// event.
+func (l *Log) Record(event *model.AuditEvent) {
+	if event.Id == "" {
+		event.Id = utils.GetGuid()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	event.Parameters = logger.RedactParameters(event.Parameters)
+
+	if err := l.sink.Append(event); err != nil {
+		logger.Error("recording audit event failed", "request_id", event.RequestId, "operation", event.Operation, "instance_id", event.InstanceId, "err", err)
+	}
+}
+
+func (l *Log) Query(filter Filter) ([]*model.AuditEvent, error) {
+	return l.sink.Query(filter)
+}
+
+func (l *Log) Close() error {
+	return l.sink.Close()
+}
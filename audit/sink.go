@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+const (
+	SINK_FILE = "file"
+
+	// The longest event FileSink.Query can read back.
+	MAX_EVENT_SIZE = 1024 * 1024
+)
+
+// Sink stores audit events. Events are only ever appended, never changed or
+// removed.
+type Sink interface {
+	Append(event *model.AuditEvent) error
+	Query(filter Filter) ([]*model.AuditEvent, error)
+	Close() error
+}
+
+func NewSink(kind, path string) (Sink, error) {
+	switch kind {
+	case SINK_FILE, "":
+		return NewFileSink(path)
+	}
+
+	return nil, errors.New(fmt.Sprintf("Invalid audit sink: %s", kind))
+}
+
+// FileSink appends events to a file, one JSON object per line.
+type FileSink struct {
+	path string
+
+	lock sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not open the audit log, message: %s", err.Error()))
+	}
+
+	return &FileSink{path: path, file: file}, nil
+}
+
+// Append writes event and syncs the file, so that an event is not reported
+// as recorded before it is on disk.
+func (s *FileSink) Append(event *model.AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Query returns the events matching filter, newest first.
+func (s *FileSink) Query(filter Filter) ([]*model.AuditEvent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []*model.AuditEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), MAX_EVENT_SIZE)
+	for scanner.Scan() {
+		var event model.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// A line cut short by a crash, the events after it are intact.
+			continue
+		}
+		if filter.Matches(&event) {
+			events = append(events, &event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.file.Close()
+}
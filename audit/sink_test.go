@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+func TestFileSinkQuery(t *testing.T) {
+	sink, path, cleanup := openTestSink(t)
+	defer cleanup()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		operation := "bind"
+		if i%2 == 1 {
+			operation = "unbind"
+		}
+		event := &model.AuditEvent{Id: strconv.Itoa(i), Time: start.Add(time.Duration(i) * time.Minute), Operation: operation}
+		if err := sink.Append(event); err != nil {
+			t.Fatal(err)
+		}
+		if i == 4 {
+			// A line cut short by a crash in the middle of the file.
+			appendToFile(t, path, `{"id":"cut","opera`+"\n")
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		ids    []string
+	}{
+		{"all events, newest first", Filter{}, []string{"9", "8", "7", "6", "5", "4", "3", "2", "1", "0"}},
+		{"newest page", Filter{Limit: 3}, []string{"9", "8", "7"}},
+		{"next page", Filter{Until: start.Add(7 * time.Minute), Limit: 3}, []string{"6", "5", "4"}},
+		{"last page", Filter{Until: start.Add(1 * time.Minute), Limit: 3}, []string{"0"}},
+		{"page of an operation", Filter{Operation: "unbind", Limit: 2}, []string{"9", "7"}},
+		{"time range", Filter{Since: start.Add(2 * time.Minute), Until: start.Add(5 * time.Minute)}, []string{"4", "3", "2"}},
+		{"limit above the matches", Filter{Operation: "bind", Since: start.Add(6 * time.Minute), Limit: 10}, []string{"8", "6"}},
+		{"no match", Filter{InstanceId: "other"}, nil},
+	}
+
+	for _, test := range tests {
+		events, err := sink.Query(test.filter)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		var ids []string
+		for _, event := range events {
+			ids = append(ids, event.Id)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%s: events %v, want %v", test.name, ids, test.ids)
+		}
+	}
+}
+
+// openTestSink opens a file sink in a new temporary directory and returns it,
+// its path and a function closing it and removing the directory.
+func openTestSink(t *testing.T) (*FileSink, string, func()) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "AuditEvents.jsonl")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return sink, path, func() {
+		sink.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func appendToFile(t *testing.T, path, content string) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
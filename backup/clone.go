@@ -0,0 +1,34 @@
+package backup
+
+import (
+	"database/sql"
+	"io"
+)
+
+// Clone copies the tables, structure and rows, of sourceDatabase on source
+// into targetDatabase on target. The broker has a single backend server and
+// passes its admin pool as both; the dump is streamed from one connection to
+// the other without being stored. progress, if not nil, is called with the
+// number of tables copied so far.
+func Clone(source *sql.DB, sourceDatabase string, target *sql.DB, targetDatabase string, progress func(done, total int)) error {
+	reader, writer := io.Pipe()
+
+	dumpErr := make(chan error, 1)
+	go func() {
+		err := dump(source, sourceDatabase, writer, progress)
+		writer.CloseWithError(err)
+		dumpErr <- err
+	}()
+
+	err := Restore(target, targetDatabase, reader)
+	// Unblock the dump if the restore gave up early.
+	reader.CloseWithError(io.ErrClosedPipe)
+
+	// Whichever side failed first makes the other one fail as well. A failed
+	// dump reaches the restore as the very error the dump returned.
+	dErr := <-dumpErr
+	if err != nil {
+		return err
+	}
+	return dErr
+}
@@ -0,0 +1,187 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Rows are written as multi-row INSERT statements of at most this many rows.
+const INSERT_BATCH_ROWS = 100
+
+// Dump writes a logical dump of database to w: the CREATE TABLE statement and
+// the rows of every base table, as SQL that can be replayed against an empty
+// database. All tables are read inside one transaction started WITH
+// CONSISTENT SNAPSHOT, so the dump reflects a single point in time of InnoDB
+// tables.
+func Dump(db *sql.DB, database string, w io.Writer) error {
+	return dump(db, database, w, nil)
+}
+
+func QuoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// Private methods
+
+// dump implements Dump, calling progress, if not nil, before the first and
+// after every dumped table.
+func dump(db *sql.DB, database string, w io.Writer, progress func(done, total int)) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Begin only takes the snapshot with the first read, by then another
+	// table may have changed. The level is set for this transaction only.
+	if _, err := conn.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "ROLLBACK")
+
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "-- datafactory-servicebroker-mysql dump of %s at %s\n", database, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(out, "SET FOREIGN_KEY_CHECKS=0;\n\n")
+
+	tables, err := listTables(ctx, conn, database)
+	if err != nil {
+		return err
+	}
+
+	if progress != nil {
+		progress(0, len(tables))
+	}
+	for i, table := range tables {
+		if err := dumpTable(ctx, conn, database, table, out); err != nil {
+			return fmt.Errorf("dump table %s: %s", table, err.Error())
+		}
+		if progress != nil {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			progress(i+1, len(tables))
+		}
+	}
+
+	fmt.Fprintf(out, "SET FOREIGN_KEY_CHECKS=1;\n")
+	return out.Flush()
+}
+
+func listTables(ctx context.Context, conn *sql.Conn, database string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SHOW FULL TABLES FROM %s WHERE Table_type = 'BASE TABLE'", QuoteIdentifier(database)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name, tableType string
+		if err := rows.Scan(&name, &tableType); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+func dumpTable(ctx context.Context, conn *sql.Conn, database, table string, out *bufio.Writer) error {
+	qualified := QuoteIdentifier(database) + "." + QuoteIdentifier(table)
+
+	var name, createTable string
+	if err := conn.QueryRowContext(ctx, "SHOW CREATE TABLE "+qualified).Scan(&name, &createTable); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "DROP TABLE IF EXISTS %s;\n", QuoteIdentifier(table))
+	fmt.Fprintf(out, "%s;\n\n", createTable)
+
+	rows, err := conn.QueryContext(ctx, "SELECT * FROM "+qualified)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	batch := 0
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return err
+		}
+
+		if batch == 0 {
+			fmt.Fprintf(out, "INSERT INTO %s VALUES\n(", QuoteIdentifier(table))
+		} else {
+			out.WriteString(",\n(")
+		}
+		for i, value := range values {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			writeValue(out, value)
+		}
+		out.WriteString(")")
+
+		batch++
+		if batch == INSERT_BATCH_ROWS {
+			out.WriteString(";\n")
+			batch = 0
+		}
+	}
+	if batch > 0 {
+		out.WriteString(";\n")
+	}
+	out.WriteString("\n")
+
+	return rows.Err()
+}
+
+func writeValue(out *bufio.Writer, value sql.RawBytes) {
+	if value == nil {
+		out.WriteString("NULL")
+		return
+	}
+
+	out.WriteByte('\'')
+	for _, b := range value {
+		switch b {
+		case 0:
+			out.WriteString(`\0`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\'':
+			out.WriteString(`\'`)
+		case '"':
+			out.WriteString(`\"`)
+		case '\032':
+			out.WriteString(`\Z`)
+		default:
+			out.WriteByte(b)
+		}
+	}
+	out.WriteByte('\'')
+}
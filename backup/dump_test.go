@@ -0,0 +1,114 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteValue(t *testing.T) {
+	tests := []struct {
+		value   sql.RawBytes
+		literal string
+	}{
+		{nil, `NULL`},
+		{sql.RawBytes(""), `''`},
+		{sql.RawBytes("plain"), `'plain'`},
+		{sql.RawBytes("it's"), `'it\'s'`},
+		{sql.RawBytes(`say "hi"`), `'say \"hi\"'`},
+		{sql.RawBytes(`back\slash`), `'back\\slash'`},
+		{sql.RawBytes("two\nlines\r"), `'two\nlines\r'`},
+		{sql.RawBytes("nul\x00ctrl-z\x1a"), `'nul\0ctrl-z\Z'`},
+		{sql.RawBytes("ends;"), `'ends;'`},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		out := bufio.NewWriter(&buffer)
+		writeValue(out, test.value)
+		out.Flush()
+
+		if buffer.String() != test.literal {
+			t.Errorf("writeValue(%q) = %s, want %s", test.value, buffer.String(), test.literal)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	db, server := newFakeServer(t, "source")
+	server.addTable("source", "people", []string{"id", "name"},
+		[]driver.Value{[]byte("1"), []byte("O'Brien")},
+		[]driver.Value{[]byte("2"), nil},
+	)
+	server.addTable("source", "empty", []string{"id"})
+
+	var dumped bytes.Buffer
+	if err := Dump(db, "source", &dumped); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"SET FOREIGN_KEY_CHECKS=0;",
+		"",
+		"DROP TABLE IF EXISTS `empty`;",
+		server.databases["source"]["empty"].create + ";",
+		"",
+		"",
+		"DROP TABLE IF EXISTS `people`;",
+		server.databases["source"]["people"].create + ";",
+		"",
+		"INSERT INTO `people` VALUES",
+		`('1','O\'Brien'),`,
+		"('2',NULL);",
+		"",
+		"SET FOREIGN_KEY_CHECKS=1;",
+		"",
+	}, "\n")
+	output := dumped.String()
+	if !strings.HasPrefix(output, "-- datafactory-servicebroker-mysql dump of source at ") {
+		t.Errorf("dump does not start with its header:\n%s", output)
+	}
+	if body := output[strings.Index(output, "\n")+1:]; body != expected {
+		t.Errorf("dump is\n%s\nwant\n%s", body, expected)
+	}
+
+	for _, statement := range []string{"START TRANSACTION WITH CONSISTENT SNAPSHOT", "ROLLBACK"} {
+		if !server.executed(statement) {
+			t.Errorf("dump did not execute %s", statement)
+		}
+	}
+}
+
+func TestDumpBatchesInserts(t *testing.T) {
+	tests := []struct {
+		rows    int
+		inserts int
+	}{
+		{0, 0},
+		{1, 1},
+		{INSERT_BATCH_ROWS, 1},
+		{INSERT_BATCH_ROWS + 1, 2},
+		{2*INSERT_BATCH_ROWS + 50, 3},
+	}
+
+	for _, test := range tests {
+		db, server := newFakeServer(t, "source")
+		var rows [][]driver.Value
+		for i := 0; i < test.rows; i++ {
+			rows = append(rows, []driver.Value{[]byte(fmt.Sprint(i))})
+		}
+		server.addTable("source", "numbers", []string{"n"}, rows...)
+
+		var dumped bytes.Buffer
+		if err := Dump(db, "source", &dumped); err != nil {
+			t.Fatal(err)
+		}
+		if inserts := strings.Count(dumped.String(), "INSERT INTO"); inserts != test.inserts {
+			t.Errorf("dump of %d rows has %d INSERT statements, want %d", test.rows, inserts, test.inserts)
+		}
+	}
+}
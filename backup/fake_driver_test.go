@@ -0,0 +1,334 @@
+package backup
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer is an in-memory stand-in for a MySQL server that understands
+// just the statements Dump and Restore send.
+type fakeServer struct {
+	lock       sync.Mutex
+	databases  map[string]map[string]*fakeTable
+	statements []string
+}
+
+type fakeTable struct {
+	create  string
+	columns []string
+	rows    [][]driver.Value
+}
+
+var (
+	fakeServersLock sync.Mutex
+	fakeServers     = make(map[string]*fakeServer)
+)
+
+func init() {
+	sql.Register("backupfake", fakeDriver{})
+}
+
+// newFakeServer returns a pool connected to a new fake server with the given
+// databases.
+func newFakeServer(t *testing.T, databases ...string) (*sql.DB, *fakeServer) {
+	server := &fakeServer{databases: make(map[string]map[string]*fakeTable)}
+	for _, database := range databases {
+		server.databases[database] = make(map[string]*fakeTable)
+	}
+
+	fakeServersLock.Lock()
+	name := fmt.Sprintf("%s-%d", t.Name(), len(fakeServers))
+	fakeServers[name] = server
+	fakeServersLock.Unlock()
+
+	db, err := sql.Open("backupfake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, server
+}
+
+func (s *fakeServer) addTable(database, name string, columns []string, rows ...[]driver.Value) {
+	definitions := make([]string, len(columns))
+	for i, column := range columns {
+		definitions[i] = "  " + QuoteIdentifier(column) + " text"
+	}
+	s.databases[database][name] = &fakeTable{
+		create:  "CREATE TABLE " + QuoteIdentifier(name) + " (\n" + strings.Join(definitions, ",\n") + "\n) ENGINE=InnoDB",
+		columns: columns,
+		rows:    rows,
+	}
+}
+
+func (s *fakeServer) executed(statement string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, executed := range s.statements {
+		if executed == statement {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeServersLock.Lock()
+	defer fakeServersLock.Unlock()
+
+	server, ok := fakeServers[name]
+	if !ok {
+		return nil, errors.New("unknown fake server " + name)
+	}
+	return &fakeConn{server: server}, nil
+}
+
+type fakeConn struct {
+	server   *fakeServer
+	database string
+}
+
+const fakeIdentifier = "`((?:[^`]|``)+)`"
+
+var (
+	showTablesStatement  = regexp.MustCompile("^SHOW FULL TABLES FROM " + fakeIdentifier + " WHERE Table_type = 'BASE TABLE'$")
+	showCreateStatement  = regexp.MustCompile("^SHOW CREATE TABLE " + fakeIdentifier + `\.` + fakeIdentifier + "$")
+	selectAllStatement   = regexp.MustCompile("^SELECT \\* FROM " + fakeIdentifier + `\.` + fakeIdentifier + "$")
+	useStatement         = regexp.MustCompile("^USE " + fakeIdentifier + "$")
+	dropTableStatement   = regexp.MustCompile("^DROP TABLE (?:IF EXISTS )?" + fakeIdentifier + "$")
+	createTableStatement = regexp.MustCompile("(?s)^CREATE TABLE " + fakeIdentifier + " \\((.*)\\) ENGINE=InnoDB$")
+	insertStatement      = regexp.MustCompile("(?s)^INSERT INTO " + fakeIdentifier + " VALUES\n(.*)$")
+	columnDefinition     = regexp.MustCompile("(?m)^  " + fakeIdentifier + " ")
+)
+
+func (c *fakeConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+	c.server.statements = append(c.server.statements, query)
+
+	if query == "SELECT DATABASE()" {
+		if c.database == "" {
+			return &fakeRows{columns: []string{"DATABASE()"}, rows: [][]driver.Value{{nil}}}, nil
+		}
+		return &fakeRows{columns: []string{"DATABASE()"}, rows: [][]driver.Value{{[]byte(c.database)}}}, nil
+	}
+
+	if match := showTablesStatement.FindStringSubmatch(query); match != nil {
+		tables, ok := c.server.databases[unquote(match[1])]
+		if !ok {
+			return nil, errors.New("unknown database " + match[1])
+		}
+		var names []string
+		for name := range tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		rows := &fakeRows{columns: []string{"Tables_in_" + unquote(match[1]), "Table_type"}}
+		for _, name := range names {
+			rows.rows = append(rows.rows, []driver.Value{[]byte(name), []byte("BASE TABLE")})
+		}
+		return rows, nil
+	}
+
+	if match := showCreateStatement.FindStringSubmatch(query); match != nil {
+		table, err := c.server.table(unquote(match[1]), unquote(match[2]))
+		if err != nil {
+			return nil, err
+		}
+		return &fakeRows{
+			columns: []string{"Table", "Create Table"},
+			rows:    [][]driver.Value{{[]byte(unquote(match[2])), []byte(table.create)}},
+		}, nil
+	}
+
+	if match := selectAllStatement.FindStringSubmatch(query); match != nil {
+		table, err := c.server.table(unquote(match[1]), unquote(match[2]))
+		if err != nil {
+			return nil, err
+		}
+		return &fakeRows{columns: table.columns, rows: table.rows}, nil
+	}
+
+	return nil, errors.New("unexpected query: " + query)
+}
+
+func (c *fakeConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+
+	statement := strings.TrimSuffix(strings.TrimSpace(query), ";")
+	c.server.statements = append(c.server.statements, statement)
+
+	if strings.HasPrefix(statement, "SET ") || strings.HasPrefix(statement, "START TRANSACTION") ||
+		statement == "ROLLBACK" || statement == "COMMIT" {
+		return driver.RowsAffected(0), nil
+	}
+
+	if match := useStatement.FindStringSubmatch(statement); match != nil {
+		if _, ok := c.server.databases[unquote(match[1])]; !ok {
+			return nil, errors.New("unknown database " + match[1])
+		}
+		c.database = unquote(match[1])
+		return driver.RowsAffected(0), nil
+	}
+
+	if c.database == "" {
+		return nil, errors.New("no database selected")
+	}
+	tables := c.server.databases[c.database]
+
+	if match := dropTableStatement.FindStringSubmatch(statement); match != nil {
+		delete(tables, unquote(match[1]))
+		return driver.RowsAffected(0), nil
+	}
+
+	if match := createTableStatement.FindStringSubmatch(statement); match != nil {
+		table := &fakeTable{create: statement}
+		for _, column := range columnDefinition.FindAllStringSubmatch(match[2], -1) {
+			table.columns = append(table.columns, unquote(column[1]))
+		}
+		tables[unquote(match[1])] = table
+		return driver.RowsAffected(0), nil
+	}
+
+	if match := insertStatement.FindStringSubmatch(statement); match != nil {
+		table, ok := tables[unquote(match[1])]
+		if !ok {
+			return nil, errors.New("unknown table " + match[1])
+		}
+		rows, err := parseFakeValues(match[2])
+		if err != nil {
+			return nil, err
+		}
+		table.rows = append(table.rows, rows...)
+		return driver.RowsAffected(len(rows)), nil
+	}
+
+	return nil, errors.New("unexpected statement: " + statement)
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+func (s *fakeServer) table(database, name string) (*fakeTable, error) {
+	table, ok := s.databases[database][name]
+	if !ok {
+		return nil, errors.New("unknown table " + database + "." + name)
+	}
+	return table, nil
+}
+
+func unquote(identifier string) string {
+	return strings.Replace(identifier, "``", "`", -1)
+}
+
+// parseFakeValues parses the row tuples of an INSERT statement as written by
+// Dump.
+func parseFakeValues(s string) ([][]driver.Value, error) {
+	var rows [][]driver.Value
+	i := 0
+	for i < len(s) {
+		if s[i] != '(' {
+			return nil, fmt.Errorf("expected ( at %d of %q", i, s)
+		}
+		i++
+
+		var row []driver.Value
+		for {
+			if strings.HasPrefix(s[i:], "NULL") {
+				row = append(row, nil)
+				i += len("NULL")
+			} else if s[i] == '\'' {
+				value := []byte{}
+				for i++; s[i] != '\''; i++ {
+					if s[i] != '\\' {
+						value = append(value, s[i])
+						continue
+					}
+					i++
+					switch s[i] {
+					case '0':
+						value = append(value, 0)
+					case 'n':
+						value = append(value, '\n')
+					case 'r':
+						value = append(value, '\r')
+					case 'Z':
+						value = append(value, '\032')
+					default:
+						value = append(value, s[i])
+					}
+				}
+				i++
+				row = append(row, value)
+			} else {
+				return nil, fmt.Errorf("unexpected value at %d of %q", i, s)
+			}
+
+			if s[i] == ')' {
+				i++
+				break
+			}
+			if s[i] != ',' {
+				return nil, fmt.Errorf("expected , at %d of %q", i, s)
+			}
+			i++
+		}
+		rows = append(rows, row)
+
+		if strings.HasPrefix(s[i:], ",\n") {
+			i += 2
+		} else if i != len(s) {
+			return nil, fmt.Errorf("unexpected %q after a row", s[i:])
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,334 @@
+package backup
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/metrics"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+var ErrBackupNotFound = errors.New("backup not found")
+
+// Manager runs backups against the admin connection, keeps their archives in
+// a Target and records their metadata in a JSON file under the data path.
+type Manager struct {
+	db       *sql.DB
+	target   Target
+	dataPath string
+	fileName string
+
+	lock    sync.Mutex
+	backups map[string]*model.Backup
+}
+
+func NewManager(db *sql.DB, target Target, dataPath, fileName string) (*Manager, error) {
+	var backups map[string]*model.Backup
+
+	err := utils.ReadAndUnmarshal(&backups, dataPath, fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Warn("backup data file does not exist", "file", fileName)
+		} else {
+			return nil, errors.New(fmt.Sprintf("Could not load the backups, message: %s", err.Error()))
+		}
+	}
+	if backups == nil {
+		backups = make(map[string]*model.Backup)
+	}
+
+	return &Manager{
+		db:       db,
+		target:   target,
+		dataPath: dataPath,
+		fileName: fileName,
+		backups:  backups,
+	}, nil
+}
+
+// FailInterrupted marks the backups that were still in progress when the
+// broker stopped as failed and deletes their partial archives. It must only
+// be called by the broker that runs the backups, at startup.
+func (m *Manager) FailInterrupted() error {
+	m.lock.Lock()
+	interrupted := false
+	for _, backup := range m.backups {
+		if backup.State == model.BACKUP_STATE_IN_PROGRESS {
+			backup.State = model.BACKUP_STATE_FAILED
+			backup.Error = "interrupted by broker restart"
+			m.target.Delete(backup.Location)
+			interrupted = true
+		}
+	}
+	m.lock.Unlock()
+
+	if !interrupted {
+		return nil
+	}
+	return m.record()
+}
+
+// Import replaces the recorded backups with the given ones. The archives
+// have to be in the target already.
+func (m *Manager) Import(backups []*model.Backup) error {
+	imported := make(map[string]*model.Backup, len(backups))
+	for _, backup := range backups {
+		b := *backup
+		imported[b.Id] = &b
+	}
+
+	m.lock.Lock()
+	m.backups = imported
+	m.lock.Unlock()
+
+	return m.record()
+}
+
+// Create dumps database into a new gzip compressed archive. The returned
+// backup is recorded even if the dump failed, with its state set to failed.
+func (m *Manager) Create(instanceId, database, kind string) (*model.Backup, error) {
+	id := utils.GetGuid()
+	backup := &model.Backup{
+		Id:         id,
+		InstanceId: instanceId,
+		Database:   database,
+		Kind:       kind,
+		Target:     m.target.Name(),
+		Location:   id + ".sql.gz",
+		State:      model.BACKUP_STATE_IN_PROGRESS,
+		CreatedAt:  time.Now(),
+	}
+
+	m.lock.Lock()
+	m.backups[id] = backup
+	m.lock.Unlock()
+
+	log := logger.New("backup_id", id, "database", database)
+	log.Info("backup started")
+	size, err := m.dump(database, backup.Location)
+	metrics.Operations.Inc("backup", metrics.Outcome(err))
+
+	finishedAt := time.Now()
+	m.lock.Lock()
+	backup.FinishedAt = &finishedAt
+	backup.Size = size
+	if err != nil {
+		log.Error("backup failed", "err", err)
+		backup.State = model.BACKUP_STATE_FAILED
+		backup.Error = err.Error()
+		m.target.Delete(backup.Location)
+	} else {
+		log.Info("backup succeeded", "size", size)
+		backup.State = model.BACKUP_STATE_SUCCEEDED
+	}
+	result := *backup
+	m.lock.Unlock()
+
+	if recordErr := m.record(); recordErr != nil {
+		return &result, recordErr
+	}
+	return &result, err
+}
+
+// List returns the backups of an instance, newest first. An empty instanceId
+// lists all backups.
+func (m *Manager) List(instanceId string) []*model.Backup {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	backups := []*model.Backup{}
+	for _, backup := range m.backups {
+		if instanceId == "" || backup.InstanceId == instanceId {
+			b := *backup
+			backups = append(backups, &b)
+		}
+	}
+	sort.Sort(backupsByCreation(backups))
+
+	return backups
+}
+
+func (m *Manager) Get(id string) (*model.Backup, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	backup, ok := m.backups[id]
+	if !ok {
+		return nil, ErrBackupNotFound
+	}
+	b := *backup
+	return &b, nil
+}
+
+func (m *Manager) Delete(id string) error {
+	m.lock.Lock()
+	backup, ok := m.backups[id]
+	if !ok {
+		m.lock.Unlock()
+		return ErrBackupNotFound
+	}
+	if backup.State == model.BACKUP_STATE_IN_PROGRESS {
+		m.lock.Unlock()
+		return errors.New(fmt.Sprintf("backup %s is still in progress", id))
+	}
+	location := backup.Location
+	m.lock.Unlock()
+
+	if err := m.target.Delete(location); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	delete(m.backups, id)
+	m.lock.Unlock()
+
+	return m.record()
+}
+
+// Prune deletes the scheduled backups of an instance that fall outside the
+// retention: the newest backup of each of the keepDaily most recent days and
+// of each of the keepWeekly most recent weeks are kept. Failed scheduled
+// backups are kept until a newer backup succeeded.
+func (m *Manager) Prune(instanceId string, keepDaily, keepWeekly int) error {
+	var scheduled []*model.Backup
+	for _, backup := range m.List(instanceId) {
+		if backup.Kind == model.BACKUP_KIND_SCHEDULED && backup.State != model.BACKUP_STATE_IN_PROGRESS {
+			scheduled = append(scheduled, backup)
+		}
+	}
+
+	keep := make(map[string]bool)
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	var newestSucceeded time.Time
+
+	// List returns the newest backups first.
+	for _, backup := range scheduled {
+		if backup.State != model.BACKUP_STATE_SUCCEEDED {
+			continue
+		}
+		if newestSucceeded.IsZero() {
+			newestSucceeded = backup.CreatedAt
+		}
+
+		day := backup.CreatedAt.Format("2006-01-02")
+		if !days[day] && len(days) < keepDaily {
+			days[day] = true
+			keep[backup.Id] = true
+		}
+
+		year, week := backup.CreatedAt.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+		if !weeks[weekKey] && len(weeks) < keepWeekly {
+			weeks[weekKey] = true
+			keep[backup.Id] = true
+		}
+	}
+
+	for _, backup := range scheduled {
+		if keep[backup.Id] {
+			continue
+		}
+		if backup.State == model.BACKUP_STATE_FAILED && !backup.CreatedAt.Before(newestSucceeded) {
+			continue
+		}
+
+		logger.Info("pruning backup", "backup_id", backup.Id, "instance_id", instanceId)
+		if err := m.Delete(backup.Id); err != nil && err != ErrBackupNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Restore replaces the contents of database with the contents of a succeeded
+// backup. The database does not need to belong to the backed up instance.
+func (m *Manager) Restore(id, database string) error {
+	backup, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	if backup.State != model.BACKUP_STATE_SUCCEEDED {
+		return errors.New(fmt.Sprintf("backup %s can not be restored, it is %s", id, backup.State))
+	}
+
+	file, err := m.target.Reader(backup.Location)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	unzipper, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer unzipper.Close()
+
+	log := logger.New("backup_id", id, "database", database)
+	log.Info("restore started")
+	err = Restore(m.db, database, unzipper)
+	metrics.Operations.Inc("restore", metrics.Outcome(err))
+	if err != nil {
+		log.Error("restore failed", "err", err)
+		return err
+	}
+	log.Info("restore succeeded")
+
+	return nil
+}
+
+// Private methods
+
+func (m *Manager) dump(database, location string) (int64, error) {
+	file, err := m.target.Writer(location)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingWriter{w: file}
+	zipper := gzip.NewWriter(counter)
+
+	err = Dump(m.db, database, zipper)
+	if closeErr := zipper.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return counter.n, err
+}
+
+func (m *Manager) record() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return utils.MarshalAndRecord(m.backups, m.dataPath, m.fileName)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type backupsByCreation []*model.Backup
+
+func (a backupsByCreation) Len() int           { return len(a) }
+func (a backupsByCreation) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a backupsByCreation) Less(i, j int) bool { return a[i].CreatedAt.After(a[j].CreatedAt) }
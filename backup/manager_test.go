@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+func TestPrune(t *testing.T) {
+	// 2024-01-01 is a Monday.
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, time.January, day, hour, 0, 0, 0, time.UTC)
+	}
+	scheduled := func(id string, state string, createdAt time.Time) *model.Backup {
+		return &model.Backup{Id: id, InstanceId: "instance", Kind: model.BACKUP_KIND_SCHEDULED, State: state, Location: id + ".sql.gz", CreatedAt: createdAt}
+	}
+
+	var threeWeeks []*model.Backup
+	for day := 1; day <= 21; day++ {
+		threeWeeks = append(threeWeeks, scheduled(at(day, 3).Format("01-02"), model.BACKUP_STATE_SUCCEEDED, at(day, 3)))
+	}
+
+	tests := []struct {
+		name                  string
+		backups               []*model.Backup
+		keepDaily, keepWeekly int
+		kept                  []string
+	}{
+		{
+			name: "newest backup of each day",
+			backups: []*model.Backup{
+				scheduled("day1-early", model.BACKUP_STATE_SUCCEEDED, at(1, 3)),
+				scheduled("day1-late", model.BACKUP_STATE_SUCCEEDED, at(1, 15)),
+				scheduled("day2-early", model.BACKUP_STATE_SUCCEEDED, at(2, 3)),
+				scheduled("day2-late", model.BACKUP_STATE_SUCCEEDED, at(2, 15)),
+				scheduled("day3", model.BACKUP_STATE_SUCCEEDED, at(3, 3)),
+			},
+			keepDaily: 2,
+			kept:      []string{"day2-late", "day3"},
+		},
+		{
+			name:       "days and weeks",
+			backups:    threeWeeks,
+			keepDaily:  3,
+			keepWeekly: 3,
+			// The last three days, and the last day of the two weeks before.
+			kept: []string{"01-07", "01-14", "01-19", "01-20", "01-21"},
+		},
+		{
+			name:       "weeks only",
+			backups:    threeWeeks,
+			keepWeekly: 2,
+			kept:       []string{"01-14", "01-21"},
+		},
+		{
+			name: "failed backups newer than the newest success",
+			backups: []*model.Backup{
+				scheduled("failed-old", model.BACKUP_STATE_FAILED, at(1, 3)),
+				scheduled("day2", model.BACKUP_STATE_SUCCEEDED, at(2, 3)),
+				scheduled("day3", model.BACKUP_STATE_SUCCEEDED, at(3, 3)),
+				scheduled("failed-new", model.BACKUP_STATE_FAILED, at(4, 3)),
+			},
+			keepDaily: 1,
+			kept:      []string{"day3", "failed-new"},
+		},
+		{
+			name: "other kinds, running backups and other instances",
+			backups: []*model.Backup{
+				{Id: "manual", InstanceId: "instance", Kind: model.BACKUP_KIND_MANUAL, State: model.BACKUP_STATE_SUCCEEDED, Location: "manual.sql.gz", CreatedAt: at(1, 3)},
+				{Id: "final", InstanceId: "instance", Kind: model.BACKUP_KIND_FINAL, State: model.BACKUP_STATE_SUCCEEDED, Location: "final.sql.gz", CreatedAt: at(1, 4)},
+				{Id: "other", InstanceId: "other", Kind: model.BACKUP_KIND_SCHEDULED, State: model.BACKUP_STATE_SUCCEEDED, Location: "other.sql.gz", CreatedAt: at(1, 5)},
+				scheduled("running", model.BACKUP_STATE_IN_PROGRESS, at(1, 6)),
+				scheduled("day2", model.BACKUP_STATE_SUCCEEDED, at(2, 3)),
+				scheduled("day3", model.BACKUP_STATE_SUCCEEDED, at(3, 3)),
+			},
+			keepDaily: 1,
+			kept:      []string{"day3", "final", "manual", "other", "running"},
+		},
+	}
+
+	for _, test := range tests {
+		manager, cleanup := newTestManager(t)
+		defer cleanup()
+		if err := manager.Import(test.backups); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := manager.Prune("instance", test.keepDaily, test.keepWeekly); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		var kept []string
+		for _, backup := range manager.List("") {
+			kept = append(kept, backup.Id)
+		}
+		sort.Strings(kept)
+		if !reflect.DeepEqual(kept, test.kept) {
+			t.Errorf("%s: kept %q, want %q", test.name, kept, test.kept)
+		}
+	}
+}
+
+// newTestManager returns a manager keeping its archives and data file in a
+// new temporary directory, and a function removing the directory.
+func newTestManager(t *testing.T) (*Manager, func()) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	manager, err := NewManager(nil, &LocalTarget{Dir: dir}, dir, "Backups.json")
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return manager, cleanup
+}
@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+)
+
+// Statements of a dump may be long multi-row INSERTs.
+const MAX_STATEMENT_LINE_SIZE = 64 * 1024 * 1024
+
+// Restore replays a dump written by Dump into database. All existing tables of
+// database are dropped first, so that afterwards it holds exactly the tables
+// and rows of the dump.
+func Restore(db *sql.DB, database string, r io.Reader) error {
+	ctx := context.Background()
+	// The dump names its tables without the database, so it is replayed on a
+	// connection of its own that USEs database. The connection goes back to
+	// the pool afterwards, with its session as it was before.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var previous sql.NullString
+	if err := conn.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&previous); err != nil {
+		return err
+	}
+	defer resetSession(ctx, conn, previous)
+
+	if _, err := conn.ExecContext(ctx, "USE "+QuoteIdentifier(database)); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS=0"); err != nil {
+		return err
+	}
+
+	if err := dropTables(ctx, conn, database); err != nil {
+		return err
+	}
+
+	err = splitStatements(r, func(statement string) error {
+		_, err := conn.ExecContext(ctx, statement)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("restore into %s: %s", database, err.Error())
+	}
+	return nil
+}
+
+// Private methods
+
+// splitStatements calls exec with every statement of a dump, in order,
+// skipping blank lines and comments between statements.
+func splitStatements(r io.Reader, exec func(statement string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_STATEMENT_LINE_SIZE)
+
+	var statement bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		if statement.Len() == 0 && (line == "" || strings.HasPrefix(line, "-- ")) {
+			continue
+		}
+
+		statement.WriteString(line)
+		statement.WriteString("\n")
+
+		// Dump escapes line breaks inside values, so a line ending in a
+		// semicolon always ends a statement.
+		if strings.HasSuffix(line, ";") {
+			if err := exec(statement.String()); err != nil {
+				return err
+			}
+			statement.Reset()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if statement.Len() > 0 {
+		return errors.New("dump ends with an incomplete statement")
+	}
+	return nil
+}
+
+// resetSession undoes the session changes of Restore. Without a default
+// database to go back to, the connection keeps the restored one selected;
+// the broker's other statements name their databases.
+func resetSession(ctx context.Context, conn *sql.Conn, previous sql.NullString) {
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS=1"); err != nil {
+		logger.Warn("resetting foreign key checks after restore failed", "err", err)
+	}
+	if previous.Valid {
+		if _, err := conn.ExecContext(ctx, "USE "+QuoteIdentifier(previous.String)); err != nil {
+			logger.Warn("resetting the default database after restore failed", "err", err)
+		}
+	}
+}
+
+func dropTables(ctx context.Context, conn *sql.Conn, database string) error {
+	tables, err := listTables(ctx, conn, database)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if _, err := conn.ExecContext(ctx, "DROP TABLE "+QuoteIdentifier(table)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name       string
+		dump       string
+		statements []string
+		valid      bool
+	}{
+		{
+			name:       "empty",
+			dump:       "",
+			statements: nil,
+			valid:      true,
+		},
+		{
+			name:       "comments and blank lines between statements",
+			dump:       "-- header\n\nSET FOREIGN_KEY_CHECKS=0;\n\n-- note\nSET FOREIGN_KEY_CHECKS=1;\n",
+			statements: []string{"SET FOREIGN_KEY_CHECKS=0;\n", "SET FOREIGN_KEY_CHECKS=1;\n"},
+			valid:      true,
+		},
+		{
+			name:       "statement over several lines",
+			dump:       "CREATE TABLE `t` (\n  `a` int\n) ENGINE=InnoDB;\n",
+			statements: []string{"CREATE TABLE `t` (\n  `a` int\n) ENGINE=InnoDB;\n"},
+			valid:      true,
+		},
+		{
+			name:       "semicolons inside values",
+			dump:       "INSERT INTO `t` VALUES\n('a;'),\n('b;\\nc');\n",
+			statements: []string{"INSERT INTO `t` VALUES\n('a;'),\n('b;\\nc');\n"},
+			valid:      true,
+		},
+		{
+			name:       "comment lines inside a statement are kept",
+			dump:       "CREATE TABLE `t` (\n-- not a comment here\n) ENGINE=InnoDB;\n",
+			statements: []string{"CREATE TABLE `t` (\n-- not a comment here\n) ENGINE=InnoDB;\n"},
+			valid:      true,
+		},
+		{
+			name:       "incomplete last statement",
+			dump:       "SET FOREIGN_KEY_CHECKS=0;\nINSERT INTO `t` VALUES\n('a'),\n",
+			statements: []string{"SET FOREIGN_KEY_CHECKS=0;\n"},
+			valid:      false,
+		},
+	}
+
+	for _, test := range tests {
+		var statements []string
+		err := splitStatements(strings.NewReader(test.dump), func(statement string) error {
+			statements = append(statements, statement)
+			return nil
+		})
+
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error = %v, want valid %v", test.name, err, test.valid)
+		}
+		if !reflect.DeepEqual(statements, test.statements) {
+			t.Errorf("%s: statements = %q, want %q", test.name, statements, test.statements)
+		}
+	}
+}
+
+func TestDumpRestoreRoundTrip(t *testing.T) {
+	rows := [][]driver.Value{
+		{[]byte("1"), []byte("plain")},
+		{[]byte("2"), []byte("it's \"quoted\"")},
+		{[]byte("3"), []byte(`back\slash`)},
+		{[]byte("4"), []byte("line\nbreak;\r\nand a semicolon;")},
+		{[]byte("5"), []byte("nul\x00ctrl-z\x1a")},
+		{[]byte("6"), nil},
+		{[]byte("7"), []byte("")},
+	}
+	for i := 0; i < 2*INSERT_BATCH_ROWS; i++ {
+		rows = append(rows, []driver.Value{[]byte("batch"), []byte(strings.Repeat("x", i))})
+	}
+
+	sourceDB, source := newFakeServer(t, "source")
+	source.addTable("source", "values", []string{"id", "value"}, rows...)
+	source.addTable("source", "with `backtick`", []string{"a"}, []driver.Value{[]byte("a")})
+
+	var dumped bytes.Buffer
+	if err := Dump(sourceDB, "source", &dumped); err != nil {
+		t.Fatal(err)
+	}
+
+	targetDB, target := newFakeServer(t, "default", "target")
+	target.addTable("target", "stale", []string{"a"}, []driver.Value{[]byte("left over")})
+	if err := Restore(targetDB, "target", &dumped); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := target.databases["target"]["stale"]; ok {
+		t.Errorf("restore kept table stale, which is not in the dump")
+	}
+	for name, table := range source.databases["source"] {
+		restored, ok := target.databases["target"][name]
+		if !ok {
+			t.Errorf("restore did not create table %s", name)
+			continue
+		}
+		if !reflect.DeepEqual(restored.columns, table.columns) {
+			t.Errorf("table %s has columns %q, want %q", name, restored.columns, table.columns)
+		}
+		if len(restored.rows) != len(table.rows) {
+			t.Errorf("table %s has %d rows, want %d", name, len(restored.rows), len(table.rows))
+			continue
+		}
+		for i := range table.rows {
+			if !reflect.DeepEqual(restored.rows[i], table.rows[i]) {
+				t.Errorf("row %d of table %s is %q, want %q", i, name, restored.rows[i], table.rows[i])
+			}
+		}
+	}
+
+	if !target.executed("SET FOREIGN_KEY_CHECKS=1") {
+		t.Errorf("restore did not turn foreign key checks back on")
+	}
+}
+
+func TestRestoreResetsDefaultDatabase(t *testing.T) {
+	db, server := newFakeServer(t, "default", "target")
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("USE `default`"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(db, "target", strings.NewReader("SET FOREIGN_KEY_CHECKS=0;\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	var database string
+	if err := db.QueryRow("SELECT DATABASE()").Scan(&database); err != nil {
+		t.Fatal(err)
+	}
+	if database != "default" {
+		t.Errorf("pooled connection uses database %s after restore, want default", database)
+	}
+	if !server.executed("USE `target`") {
+		t.Errorf("restore did not select the target database")
+	}
+}
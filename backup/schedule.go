@@ -0,0 +1,128 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression with the five standard fields:
+// minute, hour, day of month, month and day of week. Each field accepts *,
+// numbers, ranges (1-5), lists (1,15) and steps (*/15, 0-30/10). The
+// shorthands @hourly, @daily, @weekly and @monthly are understood as well.
+type Schedule struct {
+	minute, hour, dom, month, dow map[int]bool
+
+	domRestricted, dowRestricted bool
+}
+
+var scheduleShorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := scheduleShorthands[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New(fmt.Sprintf("Invalid schedule %q: expected 5 fields", spec))
+	}
+
+	// As in cron, a field starting with * does not restrict the day, even
+	// with a step such as */2.
+	s := &Schedule{
+		domRestricted: !strings.HasPrefix(fields[2], "*"),
+		dowRestricted: !strings.HasPrefix(fields[4], "*"),
+	}
+
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid schedule %q: minute: %s", spec, err.Error()))
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid schedule %q: hour: %s", spec, err.Error()))
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid schedule %q: day of month: %s", spec, err.Error()))
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid schedule %q: month: %s", spec, err.Error()))
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid schedule %q: day of week: %s", spec, err.Error()))
+	}
+	// Both 0 and 7 stand for Sunday.
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+
+	return s, nil
+}
+
+// Matches reports whether t falls into a minute selected by the schedule.
+// As in cron, if both day of month and day of week are restricted a day
+// matching either of them is selected.
+func (s *Schedule) Matches(t time.Time) bool {
+	if !s.minute[t.Minute()] || !s.hour[t.Hour()] || !s.month[int(t.Month())] {
+		return false
+	}
+
+	domMatch := s.dom[t.Day()]
+	dowMatch := s.dow[int(t.Weekday())]
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// Private methods
+
+func parseField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, errors.New(fmt.Sprintf("invalid step in %q", part))
+			}
+			step = n
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			n, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid value %q", part))
+			}
+			from, to = n, n
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, errors.New(fmt.Sprintf("invalid value %q", part))
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, errors.New(fmt.Sprintf("%q out of range %d-%d", part, min, max))
+		}
+
+		for v := from; v <= to; v += step {
+			values[v] = true
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,136 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"0 3 * * *", true},
+		{"*/15 * * * *", true},
+		{"0-30/10 8-18 * * 1-5", true},
+		{"0 0 1,15 * *", true},
+		{"0 0 * * 7", true},
+		{"@hourly", true},
+		{"@daily", true},
+		{"@weekly", true},
+		{"@monthly", true},
+		{"  0 3 * * *  ", true},
+		{"", false},
+		{"0 3 * *", false},
+		{"0 3 * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"*/x * * * *", false},
+		{"a * * * *", false},
+		{"1-x * * * *", false},
+		{"@yearly", false},
+	}
+
+	for _, test := range tests {
+		_, err := ParseSchedule(test.spec)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseSchedule(%q) error = %v, want valid %v", test.spec, err, test.valid)
+		}
+	}
+}
+
+func TestScheduleMatches(t *testing.T) {
+	// 2024-01-01 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec    string
+		time    time.Time
+		matches bool
+	}{
+		{"0 3 * * *", at(1, 3, 0), true},
+		{"0 3 * * *", at(1, 3, 1), false},
+		{"0 3 * * *", at(1, 4, 0), false},
+		{"*/15 * * * *", at(1, 10, 45), true},
+		{"*/15 * * * *", at(1, 10, 50), false},
+		{"0-30/10 * * * *", at(1, 10, 30), true},
+		{"0-30/10 * * * *", at(1, 10, 40), false},
+		{"5/20 * * * *", at(1, 10, 45), true},
+		{"5/20 * * * *", at(1, 10, 40), false},
+		{"0 0 * * 1-5", at(5, 0, 0), true},
+		{"0 0 * * 1-5", at(6, 0, 0), false},
+		// Both 0 and 7 are Sunday.
+		{"0 0 * * 0", at(7, 0, 0), true},
+		{"0 0 * * 7", at(7, 0, 0), true},
+		{"0 0 * * 7", at(8, 0, 0), false},
+		{"0 0 1 * *", at(1, 0, 0), true},
+		{"0 0 1 * *", at(2, 0, 0), false},
+		{"0 0 * 2 *", at(1, 0, 0), false},
+		// With day of month and day of week restricted either one selects
+		// the day.
+		{"0 0 15 * 0", at(15, 0, 0), true},
+		{"0 0 15 * 0", at(14, 0, 0), true},
+		{"0 0 15 * 0", at(16, 0, 0), false},
+		// A field starting with * does not restrict the day, even with a
+		// step, so the other day field has to match as well.
+		{"0 0 */2 * 1", at(1, 0, 0), true},
+		{"0 0 */2 * 1", at(3, 0, 0), false},
+		{"0 0 */2 * 1", at(8, 0, 0), false},
+		{"0 0 1 * */2", at(1, 0, 0), false},
+		{"0 0 1 * */2", at(2, 0, 0), false},
+		{"@weekly", at(7, 0, 0), true},
+		{"@weekly", at(8, 0, 0), false},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matches := schedule.Matches(test.time); matches != test.matches {
+			t.Errorf("%q matches %s = %v, want %v", test.spec, test.time.Format(time.RFC3339), matches, test.matches)
+		}
+	}
+}
+
+func TestDueMinute(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.January, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec         string
+		after, until time.Time
+		minute       time.Time
+		due          bool
+	}{
+		{"0 3 * * *", at(2, 59), at(3, 0), at(3, 0), true},
+		{"0 3 * * *", at(3, 0), at(3, 1), time.Time{}, false},
+		// A backup that ran from 2:58 to 3:20 must not make the 3:00 one
+		// be skipped.
+		{"0 3 * * *", at(2, 58), at(3, 20), at(3, 0), true},
+		// Several selected minutes in the window run once, for the latest.
+		{"*/5 * * * *", at(3, 0), at(3, 17), at(3, 15), true},
+		{"*/5 * * * *", at(3, 15), at(3, 19), time.Time{}, false},
+		{"0 3 * * *", at(3, 0), at(3, 0), time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		minute, due := dueMinute(schedule, test.after, test.until)
+		if due != test.due || !minute.Equal(test.minute) {
+			t.Errorf("%q due in (%s, %s] = %s, %v, want %s, %v", test.spec,
+				test.after.Format("15:04"), test.until.Format("15:04"), minute.Format("15:04"), due, test.minute.Format("15:04"), test.due)
+		}
+	}
+}
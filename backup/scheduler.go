@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+// InstanceLister returns the service instances the scheduler should consider.
+type InstanceLister func() []*model.ServiceInstance
+
+type planPolicy struct {
+	config.BackupPolicy
+	schedule *Schedule
+}
+
+// Scheduler checks once a minute which instances are on a plan with a backup
+// policy whose schedule is due, backs them up and prunes their old backups.
+type Scheduler struct {
+	manager   *Manager
+	instances InstanceLister
+	policies  map[string]*planPolicy
+
+	lock   sync.Mutex
+	status map[string]*model.BackupScheduleStatus
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewScheduler(manager *Manager, instances InstanceLister, policies map[string]config.BackupPolicy) (*Scheduler, error) {
+	parsed := make(map[string]*planPolicy)
+	for planId, policy := range policies {
+		schedule, err := ParseSchedule(policy.Schedule)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid backup policy of plan %s: %s", planId, err.Error()))
+		}
+		if policy.KeepDaily <= 0 && policy.KeepWeekly <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid backup policy of plan %s: keep_daily or keep_weekly must be positive", planId))
+		}
+		parsed[planId] = &planPolicy{BackupPolicy: policy, schedule: schedule}
+	}
+
+	return &Scheduler{
+		manager:   manager,
+		instances: instances,
+		policies:  parsed,
+		status:    make(map[string]*model.BackupScheduleStatus),
+	}, nil
+}
+
+func (s *Scheduler) Start() {
+	if len(s.policies) == 0 {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop()
+}
+
+// Stop waits for a running backup to finish and stops the scheduler.
+func (s *Scheduler) Stop() {
+	if s.stop == nil {
+		return
+	}
+
+	close(s.stop)
+	<-s.done
+}
+
+// Status returns the outcome of the latest scheduled backup of each instance.
+func (s *Scheduler) Status() []*model.BackupScheduleStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	statuses := []*model.BackupScheduleStatus{}
+	for _, status := range s.status {
+		copied := *status
+		statuses = append(statuses, &copied)
+	}
+	sort.Sort(statusesByInstance(statuses))
+
+	return statuses
+}
+
+// Private methods
+
+func (s *Scheduler) loop() {
+	defer close(s.done)
+
+	last := time.Now().Truncate(time.Minute)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(time.Until(last.Add(time.Minute))):
+		}
+
+		// Backups may take longer than a minute, so every minute since the
+		// last check is checked now.
+		now := time.Now().Truncate(time.Minute)
+		s.runDue(last, now)
+		last = now
+	}
+}
+
+// runDue backs up the instances whose schedule selects a minute after after
+// and up to until, each instance once however many of those minutes it
+// selects.
+func (s *Scheduler) runDue(after, until time.Time) {
+	for _, instance := range s.instances() {
+		policy, ok := s.policies[instance.PlanId]
+		if !ok {
+			continue
+		}
+		minute, due := dueMinute(policy.schedule, after, until)
+		if !due {
+			continue
+		}
+
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		s.run(instance, policy, minute)
+	}
+}
+
+func (s *Scheduler) run(instance *model.ServiceInstance, policy *planPolicy, minute time.Time) {
+	backup, err := s.manager.Create(instance.Id, instance.InternalId, model.BACKUP_KIND_SCHEDULED)
+
+	s.lock.Lock()
+	status, ok := s.status[instance.Id]
+	if !ok {
+		status = &model.BackupScheduleStatus{InstanceId: instance.Id}
+		s.status[instance.Id] = status
+	}
+	status.PlanId = instance.PlanId
+	status.Schedule = policy.Schedule
+	status.LastRun = minute
+	status.LastBackupId = ""
+	if backup != nil {
+		status.LastBackupId = backup.Id
+	}
+	if err != nil {
+		logger.Error("scheduled backup failed", "instance_id", instance.Id, "err", err)
+		status.LastState = model.BACKUP_STATE_FAILED
+		status.LastError = err.Error()
+		status.ConsecutiveFailures++
+	} else {
+		status.LastState = model.BACKUP_STATE_SUCCEEDED
+		status.LastError = ""
+		status.ConsecutiveFailures = 0
+	}
+	s.lock.Unlock()
+
+	if err := s.manager.Prune(instance.Id, policy.KeepDaily, policy.KeepWeekly); err != nil {
+		logger.Error("pruning backups failed", "instance_id", instance.Id, "err", err)
+	}
+}
+
+// dueMinute returns the latest minute after after and up to until that
+// schedule selects.
+func dueMinute(schedule *Schedule, after, until time.Time) (time.Time, bool) {
+	for minute := until.Truncate(time.Minute); minute.After(after); minute = minute.Add(-time.Minute) {
+		if schedule.Matches(minute) {
+			return minute, true
+		}
+	}
+	return time.Time{}, false
+}
+
+type statusesByInstance []*model.BackupScheduleStatus
+
+func (a statusesByInstance) Len() int           { return len(a) }
+func (a statusesByInstance) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a statusesByInstance) Less(i, j int) bool { return a[i].InstanceId < a[j].InstanceId }
@@ -0,0 +1,64 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	TARGET_LOCAL = "local"
+)
+
+// Target is where backup archives are kept. Archives are addressed by a
+// relative name such as "<backup id>.sql.gz".
+type Target interface {
+	Name() string
+	Writer(name string) (io.WriteCloser, error)
+	Reader(name string) (io.ReadCloser, error)
+	Delete(name string) error
+}
+
+func NewTarget(kind, dir string) (Target, error) {
+	switch kind {
+	case TARGET_LOCAL, "":
+		return &LocalTarget{Dir: dir}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("Invalid backup target: %s", kind))
+}
+
+// LocalTarget stores archives in a directory on the broker's file system.
+type LocalTarget struct {
+	Dir string
+}
+
+func (t *LocalTarget) Name() string {
+	return TARGET_LOCAL
+}
+
+func (t *LocalTarget) Writer(name string) (io.WriteCloser, error) {
+	path := t.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+}
+
+func (t *LocalTarget) Reader(name string) (io.ReadCloser, error) {
+	return os.Open(t.path(name))
+}
+
+func (t *LocalTarget) Delete(name string) error {
+	err := os.Remove(t.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (t *LocalTarget) path(name string) string {
+	return filepath.Join(t.Dir, filepath.FromSlash(name))
+}
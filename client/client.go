@@ -2,12 +2,14 @@ package client
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
 	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
-	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
 	_ "github.com/go-sql-driver/mysql"
-	"log"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -18,41 +20,338 @@ var (
 	DB_ADDR, DB_PORT, DB_DATABASE, DB_USER, DB_PASSWD string
 )
 
+// Client implementations log through the logger they are given, so that
+// their lines carry the id of the request being served.
 type Client interface {
-	CreateInstance(parameters interface{}) (string, error)
+	CreateInstance(log *logger.Logger, parameters interface{}) (string, error)
 	BindInstance(instanceId string, parameters interface{}) (string, error)
 	GetInstanceState(instanceId string) (string, error)
-	DeleteInstance(instance *model.ServiceInstance) error
+	DeleteInstance(log *logger.Logger, instance *model.ServiceInstance) error
 }
 
 func init() {
 	GetEnvs()
-	var err error
+}
+
+// Open opens the admin connection pool to the backend MySQL server, over TLS
+// if settings has a CA file.
+func Open(settings config.MysqlTLSConfig) error {
 	URL := fmt.Sprintf(`%s:%s@tcp(%s:%s)/%s`, DB_USER, DB_PASSWD, DB_ADDR, DB_PORT, DB_DATABASE)
-	log.Println(URL)
+
+	useTLS, err := registerTLSConfig(settings)
+	if err != nil {
+		return err
+	}
+	if useTLS {
+		URL += "?tls=" + TLS_CONFIG_NAME
+	}
+
 	DB, err = sql.Open("mysql", URL)
 	if err != nil {
-		log.Fatalln("open failed ", err)
+		return errors.New(fmt.Sprintf("Could not open the admin connection to %s, message: %s", Address(), err.Error()))
 	}
+	// The server may still be starting, /readyz reports when it is reachable.
 	if err := DB.Ping(); err != nil {
-		log.Fatalln("ping db fail", err)
+		logger.Warn("ping db failed", "address", Address(), "tls", useTLS, "err", err)
+	}
+	return nil
+}
+
+// Address returns the host and port of the backend MySQL server.
+func Address() string {
+	return fmt.Sprintf("%s:%s", DB_ADDR, DB_PORT)
+}
+
+// Ping checks that the backend MySQL server is reachable and returns how long
+// that took. It gives up after timeout.
+func Ping(timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- DB.Ping()
+	}()
+
+	select {
+	case err := <-result:
+		return time.Since(start), err
+	case <-time.After(timeout):
+		return time.Since(start), fmt.Errorf("ping %s timed out after %s", Address(), timeout)
 	}
 }
 
-func SetCredential(crd model.Credential) error {
-	log.Printf(`CREATE USER '%s'@'localhost' IDENTIFIED BY '%s';`, crd.Username, crd.Password)
-	if _, err := DB.Exec(fmt.Sprintf(`CREATE USER '%s' IDENTIFIED BY '%s';`, crd.Username, crd.Password)); err != nil {
-		log.Println("SetCredential create user err", err)
+func SetCredential(log *logger.Logger, crd model.Credential) error {
+	log.Debug("creating user", "user", crd.Username, "database", crd.Database, "require_ssl", crd.RequireSSL)
+	statement := fmt.Sprintf(`CREATE USER '%s' IDENTIFIED BY '%s'`, crd.Username, crd.Password)
+	if crd.RequireSSL {
+		statement += " REQUIRE SSL"
+	}
+	if _, err := DB.Exec(statement + ";"); err != nil {
+		log.Error("create user failed", "user", crd.Username, "err", err)
 		return err
 	}
 
-	if _, err := DB.Exec(fmt.Sprintf(`GRANT ALL PRIVILEGES ON %s.* TO '%s'@'%%'`, crd.Database, crd.Username)); err != nil {
-		log.Println("SetCredential grant err", err)
+	return GrantPrivileges(log, crd.Database, crd.Username)
+}
+
+// GrantPrivileges gives user all privileges on database.
+func GrantPrivileges(log *logger.Logger, database, user string) error {
+	if _, err := DB.Exec(fmt.Sprintf(`GRANT ALL PRIVILEGES ON %s.* TO '%s'@'%%'`, database, user)); err != nil {
+		log.Error("grant privileges failed", "user", user, "database", database, "err", err)
 		return err
 	}
 	return nil
 }
 
+// ResetCredential sets the password and SSL requirement of an existing user
+// to those of crd.
+func ResetCredential(log *logger.Logger, crd model.Credential) error {
+	log.Debug("resetting user", "user", crd.Username, "require_ssl", crd.RequireSSL)
+	statement := fmt.Sprintf(`ALTER USER '%s'@'%%' IDENTIFIED BY '%s'`, crd.Username, crd.Password)
+	if crd.RequireSSL {
+		statement += " REQUIRE SSL"
+	} else {
+		statement += " REQUIRE NONE"
+	}
+	if _, err := DB.Exec(statement + ";"); err != nil {
+		log.Error("alter user failed", "user", crd.Username, "err", err)
+		return err
+	}
+	return nil
+}
+
+// UserExists reports whether the server has an account named name.
+func UserExists(name string) (bool, error) {
+	var count int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM mysql.user WHERE User = ?", name).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// DatabaseExists reports whether the server has a database named name.
+func DatabaseExists(name string) (bool, error) {
+	var found string
+	err := DB.QueryRow("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", name).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func DropDatabase(log *logger.Logger, name string) error {
+	_, err := DB.Exec(fmt.Sprintf("DROP DATABASE %s;", name))
+	if err != nil {
+		log.Error("drop database failed", "database", name, "err", err)
+	}
+	return err
+}
+
+// RenameDatabase moves all tables of database from into a new database to and
+// drops from. MySQL has no statement to rename a database as a whole, and
+// views, triggers, stored routines and events can not be moved along with the
+// tables, so databases with any of them are refused. If a table can not be
+// moved, the ones moved already are moved back.
+func RenameDatabase(log *logger.Logger, from, to string) error {
+	if objects, err := unmovableObjects(from); err != nil {
+		return err
+	} else if len(objects) > 0 {
+		return errors.New(fmt.Sprintf("Database %s can not be renamed, it has %s", from, strings.Join(objects, ", ")))
+	}
+
+	if _, err := DB.Exec(fmt.Sprintf("CREATE DATABASE %s;", to)); err != nil {
+		log.Error("create database failed", "database", to, "err", err)
+		return err
+	}
+
+	rows, err := DB.Query(fmt.Sprintf("SHOW FULL TABLES FROM %s WHERE Table_type = 'BASE TABLE';", from))
+	if err != nil {
+		DropDatabase(log, to)
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var table, tableType string
+		if err := rows.Scan(&table, &tableType); err != nil {
+			rows.Close()
+			DropDatabase(log, to)
+			return err
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		DropDatabase(log, to)
+		return err
+	}
+
+	for i, table := range tables {
+		if _, err := DB.Exec(fmt.Sprintf("RENAME TABLE %s.`%s` TO %s.`%s`;", from, table, to, table)); err != nil {
+			log.Error("rename table failed", "database", from, "table", table, "err", err)
+			undoRenameTables(log, tables[:i], from, to)
+			return err
+		}
+	}
+
+	return DropDatabase(log, from)
+}
+
+// unmovableObjects describes what in database RenameDatabase can not move,
+// such as "2 views", or returns nothing if there is nothing of that kind.
+func unmovableObjects(database string) ([]string, error) {
+	queries := []struct {
+		kind  string
+		query string
+	}{
+		{"views", "SELECT COUNT(*) FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ?;"},
+		{"triggers", "SELECT COUNT(*) FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ?;"},
+		{"stored routines", "SELECT COUNT(*) FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ?;"},
+		{"events", "SELECT COUNT(*) FROM information_schema.EVENTS WHERE EVENT_SCHEMA = ?;"},
+	}
+
+	var objects []string
+	for _, q := range queries {
+		var count int
+		if err := DB.QueryRow(q.query, database).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			objects = append(objects, fmt.Sprintf("%d %s", count, q.kind))
+		}
+	}
+	return objects, nil
+}
+
+// undoRenameTables moves tables back from database to into database from and
+// drops to if that leaves it empty.
+func undoRenameTables(log *logger.Logger, tables []string, from, to string) {
+	for i := len(tables) - 1; i >= 0; i-- {
+		if _, err := DB.Exec(fmt.Sprintf("RENAME TABLE %s.`%s` TO %s.`%s`;", to, tables[i], from, tables[i])); err != nil {
+			// Leave to in place, it still holds the table.
+			log.Error("moving table back failed", "database", to, "table", tables[i], "err", err)
+			return
+		}
+	}
+	DropDatabase(log, to)
+}
+
+func DropUser(log *logger.Logger, name string) error {
+	_, err := DB.Exec(fmt.Sprintf("DROP USER '%s';", name))
+	if err != nil {
+		log.Error("drop user failed", "user", name, "err", err)
+	}
+	return err
+}
+
+// DatabaseSizes returns the size in bytes of the data and indexes of every
+// database on the server, by database name.
+func DatabaseSizes() (map[string]int64, error) {
+	rows, err := DB.Query("SELECT table_schema, SUM(data_length + index_length) FROM information_schema.TABLES GROUP BY table_schema;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var size sql.NullInt64
+		if err := rows.Scan(&name, &size); err != nil {
+			return nil, err
+		}
+		sizes[name] = size.Int64
+	}
+	return sizes, rows.Err()
+}
+
+// DatabaseConnections returns the number of connections using each database
+// on the server, by database name.
+func DatabaseConnections() (map[string]int, error) {
+	rows, err := DB.Query("SELECT db, COUNT(*) FROM information_schema.PROCESSLIST WHERE db IS NOT NULL GROUP BY db;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connections := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, err
+		}
+		connections[name] = count
+	}
+	return connections, rows.Err()
+}
+
+// Tables returns the tables of a database with their estimated number of rows
+// and their size, sorted by name.
+func Tables(database string) ([]*model.TableStats, error) {
+	rows, err := DB.Query("SELECT TABLE_NAME, ENGINE, TABLE_ROWS, DATA_LENGTH + INDEX_LENGTH FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME;", database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := make([]*model.TableStats, 0)
+	for rows.Next() {
+		var table model.TableStats
+		var engine sql.NullString
+		var count, size sql.NullInt64
+		if err := rows.Scan(&table.Name, &engine, &count, &size); err != nil {
+			return nil, err
+		}
+		table.Engine, table.Rows, table.SizeBytes = engine.String, count.Int64, size.Int64
+		tables = append(tables, &table)
+	}
+	return tables, rows.Err()
+}
+
+// Connections returns the connections using a database. The statements they
+// run are left out, they may contain data.
+func Connections(database string) ([]*model.Connection, error) {
+	rows, err := DB.Query("SELECT ID, USER, HOST, COMMAND, TIME, STATE FROM information_schema.PROCESSLIST WHERE DB = ? ORDER BY ID;", database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connections := make([]*model.Connection, 0)
+	for rows.Next() {
+		var connection model.Connection
+		var state sql.NullString
+		if err := rows.Scan(&connection.Id, &connection.User, &connection.Host, &connection.Command, &connection.TimeSeconds, &state); err != nil {
+			return nil, err
+		}
+		connection.State = state.String
+		connections = append(connections, &connection)
+	}
+	return connections, rows.Err()
+}
+
+// BrokerDatabases returns the names of the databases on the server that were
+// created by the broker.
+func BrokerDatabases() ([]string, error) {
+	rows, err := DB.Query(`SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME LIKE 'DB\_%';`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
 type virtualGuestProps struct {
 	hostname                     string
 	domain                       string
@@ -66,12 +365,13 @@ type SoftLayerClient struct {
 	vgProps virtualGuestProps
 }
 
-func (client *SoftLayerClient) CreateInstance(parameters interface{}) (string, error) {
+func (client *SoftLayerClient) CreateInstance(log *logger.Logger, parameters interface{}) (string, error) {
+	ctx, _ := parameters.(*model.Context)
 
-	dataBaseName := fmt.Sprintf("DB_%s", utils.GetUid())
+	dataBaseName := DatabaseName(ctx)
 	_, err := DB.Exec(fmt.Sprintf("CREATE DATABASE %s;", dataBaseName))
 	if err != nil {
-		log.Printf("CREATE DATABASE %s err: %s.", dataBaseName, err)
+		log.Error("create database failed", "database", dataBaseName, "err", err)
 		return "", err
 	}
 
@@ -82,43 +382,55 @@ func (client *SoftLayerClient) BindInstance(instanceId string, parameters interf
 	return "123", nil
 }
 
+// GetInstanceState reports an instance as running once its database exists.
 func (client *SoftLayerClient) GetInstanceState(instanceId string) (string, error) {
-	return "123", nil
+	exists, err := DatabaseExists(instanceId)
+	if err != nil {
+		return "", err
+	} else if !exists {
+		return "missing", nil
+	}
+
+	return "running", nil
 }
-func (client *SoftLayerClient) DeleteInstance(instance *model.ServiceInstance) error {
 
-	dataBaseName := instance.Id
-	log.Printf("%+v", instance)
-	if m, ok := instance.Parameters.(map[string]interface{}); ok {
-		dataBaseName = m[DATABASE_NAME].(string)
-	}
-	_, err := DB.Exec(fmt.Sprintf("DROP DATABASE %s;", dataBaseName))
-	if err != nil {
-		log.Printf("DROP DATABASE %s err: %s.", dataBaseName, err)
+// DeleteInstance drops the database of an instance, the one CreateInstance
+// returned as its internal id.
+func (client *SoftLayerClient) DeleteInstance(log *logger.Logger, instance *model.ServiceInstance) error {
+	dataBaseName := instance.InternalId
+	if dataBaseName == "" {
+		// Instances recorded before the internal id was kept name their
+		// database in the parameters, if at all.
+		dataBaseName = instance.Id
+		if m, ok := instance.Parameters.(map[string]interface{}); ok {
+			if name, ok := m[DATABASE_NAME].(string); ok && name != "" {
+				dataBaseName = name
+			}
+		}
 	}
+	log.Debug("deleting service instance", "instance_id", instance.Id, "database", dataBaseName)
 
-	return nil
+	return DropDatabase(log, dataBaseName)
 }
 func GetEnvs() {
 	DB_ADDR = os.Getenv("MYSQL_PORT_3306_TCP_ADDR")
 	if DB_ADDR == "" {
-		fmt.Println("ENV[MYSQL_PORT_3306_TCP_ADDR] is null")
+		logger.Warn("environment variable is not set", "name", "MYSQL_PORT_3306_TCP_ADDR")
 	}
 	DB_PORT = os.Getenv("MYSQL_PORT_3306_TCP_PORT")
 	if DB_PORT == "" {
-		fmt.Println("ENV[MYSQL_PORT_3306_TCP_PORT] is null")
+		logger.Warn("environment variable is not set", "name", "MYSQL_PORT_3306_TCP_PORT")
 	}
 	DB_DATABASE = os.Getenv("MYSQL_DATABASE")
 	if DB_DATABASE == "" {
-		fmt.Println("ENV[MYSQL_DATABASE] is null")
+		logger.Warn("environment variable is not set", "name", "MYSQL_DATABASE")
 	}
 	DB_USER = os.Getenv("MYSQL_USER")
 	if DB_USER == "" {
-		fmt.Println("ENV[MYSQL_USER] is null")
+		logger.Warn("environment variable is not set", "name", "MYSQL_USER")
 	}
 	DB_PASSWD = os.Getenv("MYSQL_ENV_MYSQL_ROOT_PASSWORD")
 	if DB_PASSWD == "" {
-		fmt.Println("ENV[MYSQL_ENV_MYSQL_ROOT_PASSWORD] is null")
+		logger.Warn("environment variable is not set", "name", "MYSQL_ENV_MYSQL_ROOT_PASSWORD")
 	}
-	time.Sleep(time.Minute * 5)
 }
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	MAX_TENANT_PREFIX_LENGTH = 32
+	// MySQL before 5.7 limits user names to 16 characters, a 12 character
+	// uid leaves room for a 3 character tenant prefix and the separator.
+	MAX_USER_PREFIX_LENGTH = 3
+)
+
+// DatabaseName returns a new database name for an instance. The tenant from
+// the platform context is part of the name so that databases of different
+// spaces or namespaces can be told apart on a shared server.
+func DatabaseName(ctx *model.Context) string {
+	if prefix := tenantPrefix(ctx, MAX_TENANT_PREFIX_LENGTH); prefix != "" {
+		return fmt.Sprintf("DB_%s_%s", prefix, utils.GetUid())
+	}
+	return fmt.Sprintf("DB_%s", utils.GetUid())
+}
+
+// UserName returns a new MySQL user name for an instance.
+func UserName(ctx *model.Context) string {
+	if prefix := tenantPrefix(ctx, MAX_USER_PREFIX_LENGTH); prefix != "" {
+		return fmt.Sprintf("%s_%s", prefix, utils.GetUid())
+	}
+	return utils.GetUid()
+}
+
+// Private methods
+
+func tenantPrefix(ctx *model.Context, maxLength int) string {
+	tenant := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, ctx.Tenant())
+
+	if len(tenant) > maxLength {
+		tenant = tenant[:maxLength]
+	}
+	return tenant
+}
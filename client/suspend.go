@@ -0,0 +1,124 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+)
+
+// The server error for statements it can not parse, which is what servers
+// without account locking report for ACCOUNT LOCK.
+const ER_PARSE_ERROR = 1064
+
+var ErrAccountLockUnsupported = errors.New("the server does not support locking accounts")
+
+// Older servers print the password hash of the user with its grants. Running
+// such a grant again sets the password back to that hash.
+var identifiedClause = regexp.MustCompile(`(?i)\s+IDENTIFIED\s+(BY\s+PASSWORD|WITH\s+'?\w+'?\s+AS)\s+'[^']*'`)
+
+// Grants returns the GRANT statements of a user, as SHOW GRANTS prints them
+// but without password hashes.
+func Grants(user string) ([]string, error) {
+	rows, err := DB.Query(fmt.Sprintf("SHOW GRANTS FOR '%s'@'%%';", user))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []string
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return nil, err
+		}
+		grants = append(grants, StripPassword(grant))
+	}
+	return grants, rows.Err()
+}
+
+// StripPassword removes the password hash from a GRANT statement.
+func StripPassword(grant string) string {
+	return identifiedClause.ReplaceAllString(grant, "")
+}
+
+// LockUser locks the account of a user so that it can not log in. Servers
+// before MySQL 5.7.6 and MariaDB 10.4 do not support this, LockUser returns
+// ErrAccountLockUnsupported for them.
+func LockUser(log *logger.Logger, user string) error {
+	_, err := DB.Exec(fmt.Sprintf("ALTER USER '%s'@'%%' ACCOUNT LOCK;", user))
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == ER_PARSE_ERROR {
+		log.Warn("lock user is not supported", "user", user, "err", err)
+		return ErrAccountLockUnsupported
+	} else if err != nil {
+		log.Error("lock user failed", "user", user, "err", err)
+	}
+	return err
+}
+
+func UnlockUser(log *logger.Logger, user string) error {
+	_, err := DB.Exec(fmt.Sprintf("ALTER USER '%s'@'%%' ACCOUNT UNLOCK;", user))
+	if err != nil {
+		log.Error("unlock user failed", "user", user, "err", err)
+	}
+	return err
+}
+
+// RevokePrivileges takes all privileges away from a user, it can still log
+// in but not use any database.
+func RevokePrivileges(log *logger.Logger, user string) error {
+	_, err := DB.Exec(fmt.Sprintf("REVOKE ALL PRIVILEGES, GRANT OPTION FROM '%s'@'%%';", user))
+	if err != nil {
+		log.Error("revoke privileges failed", "user", user, "err", err)
+	}
+	return err
+}
+
+// ApplyGrants runs GRANT statements as returned by Grants. Password hashes
+// left in grants recorded by older brokers are dropped, so that the grants
+// do not undo a password change.
+func ApplyGrants(log *logger.Logger, grants []string) error {
+	for _, grant := range grants {
+		grant = StripPassword(grant)
+		if _, err := DB.Exec(grant); err != nil {
+			log.Error("grant failed", "grant", grant, "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// KillConnections closes the connections of a user and returns how many
+// there were. Connections that end on their own meanwhile are not an error.
+func KillConnections(log *logger.Logger, user string) (int, error) {
+	rows, err := DB.Query("SELECT ID FROM information_schema.PROCESSLIST WHERE USER = ?", user)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	killed := 0
+	for _, id := range ids {
+		if _, err := DB.Exec(fmt.Sprintf("KILL CONNECTION %d;", id)); err != nil {
+			log.Debug("kill connection failed", "user", user, "connection", id, "err", err)
+			continue
+		}
+		killed++
+	}
+	return killed, nil
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestStripPassword(t *testing.T) {
+	tests := []struct {
+		grant    string
+		stripped string
+	}{
+		{
+			"GRANT USAGE ON *.* TO 'u'@'%' IDENTIFIED BY PASSWORD '*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19'",
+			"GRANT USAGE ON *.* TO 'u'@'%'",
+		},
+		{
+			"GRANT USAGE ON *.* TO 'u'@'%' identified by password '*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19' REQUIRE SSL",
+			"GRANT USAGE ON *.* TO 'u'@'%' REQUIRE SSL",
+		},
+		{
+			"GRANT USAGE ON *.* TO 'u'@'%' IDENTIFIED WITH 'mysql_native_password' AS '*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19'",
+			"GRANT USAGE ON *.* TO 'u'@'%'",
+		},
+		{
+			"GRANT ALL PRIVILEGES ON `db1`.* TO 'u'@'%'",
+			"GRANT ALL PRIVILEGES ON `db1`.* TO 'u'@'%'",
+		},
+	}
+
+	for _, test := range tests {
+		if stripped := StripPassword(test.grant); stripped != test.stripped {
+			t.Errorf("StripPassword(%q) = %q, want %q", test.grant, stripped, test.stripped)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+)
+
+// TLS_CONFIG_NAME is the name the admin TLS configuration is registered
+// under with the MySQL driver.
+const TLS_CONFIG_NAME = "broker"
+
+// The PEM encoded CA of the backend server, handed out to bindings that
+// require SSL.
+var caCertificate string
+
+// CACertificate returns the PEM encoded CA certificates that the backend
+// server's certificate is verified against, or "" if TLS is not configured.
+func CACertificate() string {
+	return caCertificate
+}
+
+// Private methods
+
+func registerTLSConfig(settings config.MysqlTLSConfig) (bool, error) {
+	if settings.CAFile == "" {
+		if settings.CertFile != "" || settings.KeyFile != "" {
+			return false, errors.New("Invalid mysql_tls settings: ca_file is required")
+		}
+		return false, nil
+	}
+
+	pem, err := ioutil.ReadFile(settings.CAFile)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("Could not load the mysql CA, message: %s", err.Error()))
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return false, errors.New(fmt.Sprintf("Could not load the mysql CA, message: no certificate found in %s", settings.CAFile))
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:    pool,
+		ServerName: settings.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return false, errors.New(fmt.Sprintf("Could not load the mysql client certificate, message: %s", err.Error()))
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if err := mysql.RegisterTLSConfig(TLS_CONFIG_NAME, tlsConfig); err != nil {
+		return false, err
+	}
+
+	caCertificate = string(pem)
+	return true, nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	webs "github.com/asiainfoLDP/datafactory-servicebroker-mysql/web_server"
+)
+
+// Operator commands work on the configured store and backend server
+// directly. Commands that change the store must not run while a broker is
+// serving from the same data path, it would overwrite their changes.
+type command struct {
+	name string
+	args string
+	help string
+	run  func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "", "serve the broker API (the default)", func([]string) error { return serve() }},
+	{"catalog validate", "", "check the catalog of the cloud", catalogValidate},
+	{"instances list", "[-org guid] [-space guid] [-plan id] [-server host:port] [-state state] [-json]", "list service instances", instancesList},
+	{"instances show", "<instance_id>", "show a service instance and its bindings", instancesShow},
+	{"instances suspend", "[-reason text] <instance_id>", "lock the user of a service instance out and kill its connections", instancesSuspend},
+	{"instances resume", "<instance_id>", "let the user of a suspended service instance connect again", instancesResume},
+	{"bindings list", "[-instance id] [-org guid] [-space guid] [-plan id] [-json]", "list service bindings", bindingsList},
+	{"quotas list", "[-json]", "list the quota policies and their usage", quotasList},
+	{"reconcile", "[-repair]", "compare the store with the backend server, -repair resyncs the instances", reconcile},
+	{"backup create", "<instance_id>", "take a manual backup of a service instance", backupCreate},
+	{"backup list", "[-instance id] [-json]", "list backups", backupList},
+	{"backup restore", "-confirm <backup_id> <instance_id>", "replace the data of a service instance with a backup", backupRestore},
+	{"store migrate", "", "update the store files to the current format", storeMigrate},
+	{"store export", "[-o file]", "write the whole store as JSON, to stdout by default", storeExport},
+	{"store import", "[-replace] <file>", "load a store export, -replace overwrites a store that has instances", storeImport},
+}
+
+// runCommand runs the command named by the first one or two words of args.
+func runCommand(args []string) error {
+	if args[0] == "help" {
+		usage()
+		return nil
+	}
+
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd.run(args[len(words):])
+		}
+	}
+
+	usage()
+	return errors.New(fmt.Sprintf("Unknown command: %s", strings.Join(args, " ")))
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-c config] [--cloud name] [command]\n\nOptions:\n", os.Args[0])
+	flag.PrintDefaults()
+
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.help)
+	}
+	w.Flush()
+}
+
+func catalogValidate(args []string) error {
+	catalog, err := webs.LoadCatalog(options.Cloud)
+	if err != nil {
+		return err
+	}
+	if err := catalog.Validate(); err != nil {
+		return err
+	}
+
+	plans := 0
+	for _, service := range catalog.Services {
+		plans += len(service.Plans)
+	}
+	fmt.Printf("catalog is valid: %d services, %d plans\n", len(catalog.Services), plans)
+	return nil
+}
+
+func instancesList(args []string) error {
+	var filter model.InstanceFilter
+	flags := flag.NewFlagSet("instances list", flag.ContinueOnError)
+	flags.StringVar(&filter.OrganizationGuid, "org", "", "organization guid")
+	flags.StringVar(&filter.SpaceGuid, "space", "", "space guid")
+	flags.StringVar(&filter.PlanId, "plan", "", "plan id")
+	flags.StringVar(&filter.Server, "server", "", "backend server host:port")
+	flags.StringVar(&filter.State, "state", "", "state of the last operation")
+	asJson := flags.Bool("json", false, "print JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	instances := ctl.ListInstances(logger.New("command", "instances list"), filter)
+	if *asJson {
+		return printJson(instances)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPLAN\tORGANIZATION\tSPACE\tSERVER\tSTATE\tSIZE\tCONNECTIONS\tBINDINGS")
+	for _, instance := range instances {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n", instance.Id, instance.PlanId, instance.OrganizationGuid,
+			instance.SpaceGuid, instance.Server, instance.State, instance.SizeBytes, instance.Connections, instance.Bindings)
+	}
+	return w.Flush()
+}
+
+func instancesShow(args []string) error {
+	if len(args) != 1 {
+		return errors.New("instances show takes the instance id")
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	detail := ctl.InstanceDetail(logger.New("command", "instances show"), args[0])
+	if detail == nil {
+		return webs.ErrInstanceNotFound
+	}
+	return printJson(detail)
+}
+
+func instancesSuspend(args []string) error {
+	flags := flag.NewFlagSet("instances suspend", flag.ContinueOnError)
+	reason := flags.String("reason", "", "why the instance is suspended")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("instances suspend takes the instance id")
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	suspension, err := ctl.SuspendInstance(logger.New("command", "instances suspend"), flags.Arg(0), *reason)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("suspended service instance %s: user %s, %s, %d connections killed\n", flags.Arg(0),
+		suspension.Username, suspension.Method, suspension.KilledConnections)
+	return nil
+}
+
+func instancesResume(args []string) error {
+	if len(args) != 1 {
+		return errors.New("instances resume takes the instance id")
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	if err := ctl.ResumeInstance(logger.New("command", "instances resume"), args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("resumed service instance %s\n", args[0])
+	return nil
+}
+
+func bindingsList(args []string) error {
+	var filter model.InstanceFilter
+	flags := flag.NewFlagSet("bindings list", flag.ContinueOnError)
+	instanceId := flags.String("instance", "", "service instance id")
+	flags.StringVar(&filter.OrganizationGuid, "org", "", "organization guid")
+	flags.StringVar(&filter.SpaceGuid, "space", "", "space guid")
+	flags.StringVar(&filter.PlanId, "plan", "", "plan id")
+	asJson := flags.Bool("json", false, "print JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	bindings := ctl.ListBindings(*instanceId, filter)
+	if *asJson {
+		return printJson(bindings)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tINSTANCE\tPLAN\tENDPOINT\tFORMATS")
+	for _, binding := range bindings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", binding.Id, binding.ServiceInstanceId, binding.ServicePlanId,
+			binding.Endpoint, strings.Join(binding.CredentialFormats, ","))
+	}
+	return w.Flush()
+}
+
+func quotasList(args []string) error {
+	flags := flag.NewFlagSet("quotas list", flag.ContinueOnError)
+	asJson := flags.Bool("json", false, "print JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	usages := ctl.QuotaUsages(logger.New("command", "quotas list"))
+	if *asJson {
+		return printJson(usages)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCOPE\tID\tPLAN\tUSED\tLIMIT")
+	for _, usage := range usages {
+		for _, plan := range usage.Instances {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", usage.Scope, usage.Id, plan.PlanId, plan.Used, plan.Limit)
+		}
+		if usage.MaxStorageMB > 0 {
+			fmt.Fprintf(w, "%s\t%s\tstorage (MB)\t%d\t%d\n", usage.Scope, usage.Id, usage.StorageBytes/webs.BYTES_PER_MB, usage.MaxStorageMB)
+		}
+	}
+	return w.Flush()
+}
+
+func reconcile(args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "recreate missing users and reapply passwords and privileges")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	report, err := ctl.Reconcile(logger.New("command", "reconcile"), *repair)
+	if err != nil {
+		return err
+	}
+	return printJson(report)
+}
+
+func backupCreate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("backup create takes the instance id")
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	result, err := ctl.CreateBackup(args[0])
+	if err != nil {
+		return err
+	}
+	return printJson(result)
+}
+
+func backupList(args []string) error {
+	flags := flag.NewFlagSet("backup list", flag.ContinueOnError)
+	instanceId := flags.String("instance", "", "service instance id")
+	asJson := flags.Bool("json", false, "print JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	backups := ctl.ListBackups(*instanceId)
+	if *asJson {
+		return printJson(backups)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tINSTANCE\tKIND\tSTATE\tSIZE\tCREATED")
+	for _, backup := range backups {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", backup.Id, backup.InstanceId, backup.Kind, backup.State,
+			backup.Size, backup.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func backupRestore(args []string) error {
+	flags := flag.NewFlagSet("backup restore", flag.ContinueOnError)
+	confirm := flags.Bool("confirm", false, "confirm that the current data of the instance is dropped")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("backup restore takes the backup id and the instance id")
+	}
+	if !*confirm {
+		return errors.New("restore drops the current data of the instance, pass -confirm to proceed")
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	if err := ctl.RestoreBackup(flags.Arg(0), flags.Arg(1)); err != nil {
+		return err
+	}
+	fmt.Printf("restored backup %s into service instance %s\n", flags.Arg(0), flags.Arg(1))
+	return nil
+}
+
+func storeMigrate(args []string) error {
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	changes, err := ctl.MigrateStore(logger.New("command", "store migrate"))
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	fmt.Printf("store migrated, %d changes\n", len(changes))
+	return nil
+}
+
+func storeExport(args []string) error {
+	flags := flag.NewFlagSet("store export", flag.ContinueOnError)
+	output := flags.String("o", "", "file to write the export to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return printJson(ctl.ExportStore())
+	}
+
+	bytes, err := json.MarshalIndent(ctl.ExportStore(), "", "  ")
+	if err != nil {
+		return err
+	}
+	// The export carries the credentials of every instance.
+	return ioutil.WriteFile(*output, bytes, 0600)
+}
+
+func storeImport(args []string) error {
+	flags := flag.NewFlagSet("store import", flag.ContinueOnError)
+	replace := flags.Bool("replace", false, "overwrite a store that has service instances")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("store import takes the export file")
+	}
+
+	bytes, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var export model.StoreExport
+	if err := json.Unmarshal(bytes, &export); err != nil {
+		return errors.New(fmt.Sprintf("Could not read the store export, message: %s", err.Error()))
+	}
+
+	ctl, err := webs.OpenController(options.Cloud)
+	if err != nil {
+		return err
+	}
+	if err := ctl.ImportStore(&export, *replace); err != nil {
+		return err
+	}
+	fmt.Printf("imported %d service instances, %d bindings and %d backups\n", len(export.Instances), len(export.Bindings), len(export.Backups))
+	return nil
+}
+
+// Private func
+
+func printJson(object interface{}) error {
+	bytes, err := json.MarshalIndent(object, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bytes))
+	return nil
+}
@@ -13,6 +13,137 @@ type Config struct {
 	ServiceInstancesFileName   string `json:"service_instances_file_name"`
 	ServiceBindingsFileName    string `json:"service_bindings_file_name"`
 	ServicdCredentialsFileName string `json:"service_credentials_file_name"`
+	MinBrokerApiVersion        string `json:"min_broker_api_version"`
+	AdminUsername              string `json:"admin_username"`
+	AdminPassword              string `json:"admin_password"`
+	BackupsFileName            string `json:"backups_file_name"`
+	BackupTarget               string `json:"backup_target"`
+	BackupDir                  string `json:"backup_dir"`
+	DeletedInstancesFileName   string `json:"deleted_instances_file_name"`
+	SuspensionsFileName        string `json:"suspensions_file_name"`
+	DeprovisionFinalSnapshot   bool   `json:"deprovision_final_snapshot"`
+	SoftDeleteGracePeriod      string `json:"soft_delete_grace_period"`
+	LogLevel                   string `json:"log_level"`
+	LogFormat                  string `json:"log_format"`
+	AuditSink                  string `json:"audit_sink"`
+	AuditLogFileName           string `json:"audit_log_file_name"`
+	UsageLogFileName           string `json:"usage_log_file_name"`
+	UsageSampleInterval        string `json:"usage_sample_interval"`
+	WebhookDeadLetterFileName  string `json:"webhook_dead_letter_file_name"`
+	ShutdownTimeout            string `json:"shutdown_timeout"`
+
+	// BackupPolicies are keyed by plan id.
+	BackupPolicies map[string]BackupPolicy `json:"backup_policies"`
+
+	TLS TLSConfig `json:"tls"`
+	// MysqlTLS secures the admin connection to the backend MySQL server.
+	MysqlTLS MysqlTLSConfig `json:"mysql_tls"`
+
+	// PlanOptions are keyed by plan id.
+	PlanOptions map[string]PlanOptions `json:"plan_options"`
+	// AdvertisedEndpoints are keyed by the host:port address the broker
+	// reaches a backend server on.
+	AdvertisedEndpoints map[string]ServerEndpoints `json:"advertised_endpoints"`
+
+	Quotas QuotaConfig `json:"quotas"`
+
+	Webhooks []WebhookConfig `json:"webhooks"`
+
+	Dashboard DashboardConfig `json:"dashboard"`
+}
+
+type BackupPolicy struct {
+	Schedule   string `json:"schedule"`
+	KeepDaily  int    `json:"keep_daily"`
+	KeepWeekly int    `json:"keep_weekly"`
+}
+
+// TLSConfig enables HTTPS when CertFile and KeyFile are set.
+type TLSConfig struct {
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	MinVersion   string `json:"min_version"`
+	CipherPolicy string `json:"cipher_policy"`
+
+	// ClientAuth is none, optional or require. Client certificates are
+	// verified against the CAs in ClientCAFile.
+	ClientAuth   string `json:"client_auth"`
+	ClientCAFile string `json:"client_ca_file"`
+	// AdminClientNames are the common names of client certificates that may
+	// use the admin API without the admin credentials.
+	AdminClientNames []string `json:"admin_client_names"`
+}
+
+// MysqlTLSConfig enables TLS for the admin connection when CAFile is set.
+// CertFile and KeyFile are only needed if the server verifies clients.
+type MysqlTLSConfig struct {
+	CAFile     string `json:"ca_file"`
+	CertFile   string `json:"cert_file"`
+	KeyFile    string `json:"key_file"`
+	ServerName string `json:"server_name"`
+}
+
+type PlanOptions struct {
+	// RequireSSL creates the users of the plan's instances with REQUIRE SSL
+	// and hands out the CA of the backend server with their credentials.
+	RequireSSL bool `json:"require_ssl"`
+}
+
+// QuotaConfig holds quota policies keyed by Cloud Foundry organization guid,
+// space guid or Kubernetes namespace. An instance has to fit into every
+// policy that applies to it.
+type QuotaConfig struct {
+	Organizations map[string]QuotaPolicy `json:"organizations"`
+	Spaces        map[string]QuotaPolicy `json:"spaces"`
+	Namespaces    map[string]QuotaPolicy `json:"namespaces"`
+}
+
+type QuotaPolicy struct {
+	// MaxInstances limits the number of instances by plan id, "*" limits
+	// the instances of all plans together.
+	MaxInstances map[string]int `json:"max_instances"`
+	// MaxStorageMB limits the total size of the databases, 0 means no limit.
+	MaxStorageMB int64 `json:"max_storage_mb"`
+}
+
+// WebhookConfig is an endpoint that lifecycle events are posted to. Payloads
+// are signed with Secret. Events lists the events the endpoint receives,
+// provision, deprovision, bind, unbind or failure, all of them if empty.
+type WebhookConfig struct {
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	// MaxAttempts is how often a delivery is tried before the event is
+	// written to the dead letter file, 5 if not set.
+	MaxAttempts int `json:"max_attempts"`
+	// Timeout of a single delivery attempt, 10s if not set.
+	Timeout string `json:"timeout"`
+}
+
+// DashboardConfig enables the per-instance dashboard when BaseUrl, the
+// address users reach the broker on, is set. Without UaaUrl and
+// CloudControllerUrl, dashboard URLs carry a token signed with Secret that
+// does not expire. With both set, users sign in with the dashboard_client of
+// the catalog instead and need permission to manage the instance.
+type DashboardConfig struct {
+	BaseUrl            string `json:"base_url"`
+	Secret             string `json:"secret"`
+	UaaUrl             string `json:"uaa_url"`
+	CloudControllerUrl string `json:"cloud_controller_url"`
+}
+
+// ServerEndpoints are the addresses apps reach a backend server on, from
+// inside the platform's network and from outside of it.
+type ServerEndpoints struct {
+	Internal Endpoint `json:"internal"`
+	External Endpoint `json:"external"`
+}
+
+// Endpoint is a hostname and port put into credentials. The host may be the
+// DNS name of a proxy or a service in front of the server.
+type Endpoint struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
 }
 
 var (
@@ -1,11 +1,18 @@
 package errors
 
 import (
-	"fmt"
+	"encoding/json"
+)
+
+// Error codes defined by the service broker API for the "error" field.
+const (
+	ASYNC_REQUIRED    = "AsyncRequired"
+	CONCURRENCY_ERROR = "ConcurrencyError"
 )
 
 type BrokerError struct {
 	wrapped_err error
+	code        string
 }
 
 func NewBrokerError(err error) *BrokerError {
@@ -14,10 +21,27 @@ func NewBrokerError(err error) *BrokerError {
 	}
 }
 
+func NewBrokerErrorWithCode(code string, err error) *BrokerError {
+	return &BrokerError{
+		wrapped_err: err,
+		code:        code,
+	}
+}
+
 func (e *BrokerError) Error() string {
 	return e.wrapped_err.Error()
 }
 
+func (e *BrokerError) Code() string {
+	return e.code
+}
+
 func (e *BrokerError) ToJson() string {
-	return fmt.Sprintf("{ \"description\": \"%s\"}", e.wrapped_err.Error())
+	body := map[string]string{"description": e.wrapped_err.Error()}
+	if e.code != "" {
+		body["error"] = e.code
+	}
+
+	bytes, _ := json.Marshal(body)
+	return string(bytes)
 }
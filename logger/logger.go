@@ -0,0 +1,168 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	DEBUG Level = iota
+	INFO
+	WARN
+	ERROR
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+var levelNames = map[Level]string{
+	DEBUG: "debug",
+	INFO:  "info",
+	WARN:  "warn",
+	ERROR: "error",
+}
+
+var (
+	lock       sync.Mutex
+	minLevel   Level     = INFO
+	jsonFormat bool      = false
+	output     io.Writer = os.Stderr
+)
+
+// Configure sets the minimum level, one of debug, info, warn or error, and
+// the output format, text or json. Empty values keep the defaults.
+func Configure(level, format string) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if level != "" {
+		found := false
+		for l, name := range levelNames {
+			if strings.EqualFold(level, name) {
+				minLevel = l
+				found = true
+			}
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("Invalid log level: %s", level))
+		}
+	}
+
+	switch format {
+	case "", FORMAT_TEXT:
+		jsonFormat = false
+	case FORMAT_JSON:
+		jsonFormat = true
+	default:
+		return errors.New(fmt.Sprintf("Invalid log format: %s", format))
+	}
+
+	return nil
+}
+
+func SetOutput(w io.Writer) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	output = w
+}
+
+// Logger writes leveled log lines carrying a fixed set of key/value fields,
+// such as the request id. A nil *Logger logs without fields.
+type Logger struct {
+	fields []interface{}
+}
+
+// New returns a logger with the given alternating keys and values.
+func New(fields ...interface{}) *Logger {
+	return &Logger{fields: fields}
+}
+
+// With returns a logger with the fields of l followed by the given ones.
+func (l *Logger) With(fields ...interface{}) *Logger {
+	var merged []interface{}
+	if l != nil {
+		merged = append(merged, l.fields...)
+	}
+	return &Logger{fields: append(merged, fields...)}
+}
+
+func (l *Logger) Debug(msg string, fields ...interface{}) { l.log(DEBUG, msg, fields) }
+func (l *Logger) Info(msg string, fields ...interface{})  { l.log(INFO, msg, fields) }
+func (l *Logger) Warn(msg string, fields ...interface{})  { l.log(WARN, msg, fields) }
+func (l *Logger) Error(msg string, fields ...interface{}) { l.log(ERROR, msg, fields) }
+
+func Debug(msg string, fields ...interface{}) { (*Logger)(nil).log(DEBUG, msg, fields) }
+func Info(msg string, fields ...interface{})  { (*Logger)(nil).log(INFO, msg, fields) }
+func Warn(msg string, fields ...interface{})  { (*Logger)(nil).log(WARN, msg, fields) }
+func Error(msg string, fields ...interface{}) { (*Logger)(nil).log(ERROR, msg, fields) }
+
+// Private methods
+
+func (l *Logger) log(level Level, msg string, fields []interface{}) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if level < minLevel {
+		return
+	}
+
+	var all []interface{}
+	if l != nil {
+		all = append(all, l.fields...)
+	}
+	all = append(all, fields...)
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	msg = Redact(msg)
+
+	if jsonFormat {
+		entry := map[string]interface{}{
+			"time":  now,
+			"level": levelNames[level],
+			"msg":   msg,
+		}
+		for i := 0; i < len(all); i += 2 {
+			key, value := fieldAt(all, i)
+			entry[key] = redactField(key, value)
+		}
+		bytes, _ := json.Marshal(entry)
+		output.Write(append(bytes, '\n'))
+		return
+	}
+
+	var line []string
+	line = append(line, now, strings.ToUpper(levelNames[level]), msg)
+	for i := 0; i < len(all); i += 2 {
+		key, value := fieldAt(all, i)
+		text := fmt.Sprint(redactField(key, value))
+		if strings.ContainsAny(text, " \t\n\"=") {
+			text = fmt.Sprintf("%q", text)
+		}
+		line = append(line, key+"="+text)
+	}
+	fmt.Fprintln(output, strings.Join(line, " "))
+}
+
+func fieldAt(fields []interface{}, i int) (string, interface{}) {
+	key := fmt.Sprint(fields[i])
+	if i+1 >= len(fields) {
+		return key, "(missing)"
+	}
+
+	value := fields[i+1]
+	if err, ok := value.(error); ok && err != nil {
+		value = err.Error()
+	}
+	return key, value
+}
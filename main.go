@@ -7,6 +7,7 @@ import (
 	"os"
 
 	conf "github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
 	utils "github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
 	webs "github.com/asiainfoLDP/datafactory-servicebroker-mysql/web_server"
 )
@@ -24,27 +25,49 @@ func init() {
 
 	flag.StringVar(&options.Cloud, "cloud", utils.SQL, "use '--cloud' option to specify the cloud client to use: AWS or SoftLayer (SL)")
 
-	flag.Parse()
+	flag.Usage = usage
 }
 
 func main() {
+	flag.Parse()
+
 	err := checkCloudName(options.Cloud)
 	if err != nil {
-		fmt.Println(err.Error())
+		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
-	_, err = conf.LoadConfig(options.ConfigPath)
+	config, err := conf.LoadConfig(options.ConfigPath)
 	if err != nil {
 		panic(fmt.Sprintf("Error loading config file [%s]...", err.Error()))
 	}
 
+	err = logger.Configure(config.LogLevel, config.LogFormat)
+	if err != nil {
+		panic(fmt.Sprintf("Error configuring logger [%s]...", err.Error()))
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	if err := runCommand(args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+func serve() error {
 	server, err := webs.CreateServer(options.Cloud)
 	if err != nil {
-		panic(fmt.Sprintf("Error creating server [%s]...", err.Error))
+		panic(fmt.Sprintf("Error creating server [%s]...", err.Error()))
 	}
 
-	server.Start()
+	if err := server.Start(); err != nil {
+		return errors.New(fmt.Sprintf("server failed: %s", err.Error()))
+	}
+	return nil
 }
 
 // Private func
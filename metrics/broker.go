@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+)
+
+const (
+	OUTCOME_SUCCEEDED = "succeeded"
+	OUTCOME_ACCEPTED  = "accepted"
+	OUTCOME_FAILED    = "failed"
+)
+
+var (
+	Requests = NewCounterVec("broker_http_requests_total",
+		"Number of service broker API requests by route, method and status code.",
+		"route", "method", "code")
+
+	RequestDuration = NewHistogramVec("broker_http_request_duration_seconds",
+		"Latency of service broker API requests by route and method.",
+		DEFAULT_BUCKETS, "route", "method")
+
+	Operations = NewCounterVec("broker_operations_total",
+		"Number of broker operations such as provision, bind or backup by outcome.",
+		"operation", "outcome")
+)
+
+func init() {
+	Register(Requests)
+	Register(RequestDuration)
+	Register(Operations)
+}
+
+// Outcome returns OUTCOME_FAILED if err is not nil and OUTCOME_SUCCEEDED
+// otherwise.
+func Outcome(err error) string {
+	if err != nil {
+		return OUTCOME_FAILED
+	}
+	return OUTCOME_SUCCEEDED
+}
+
+// StatusOutcome returns the outcome of an operation answered with the HTTP
+// status code status.
+func StatusOutcome(status int) string {
+	if status == http.StatusAccepted {
+		return OUTCOME_ACCEPTED
+	} else if status >= 400 {
+		return OUTCOME_FAILED
+	}
+	return OUTCOME_SUCCEEDED
+}
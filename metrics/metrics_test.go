@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVecWrite(t *testing.T) {
+	counter := NewCounterVec("test_total", "A test counter.", "operation", "outcome")
+	counter.Inc("provision", OUTCOME_SUCCEEDED)
+	counter.Inc("provision", OUTCOME_SUCCEEDED)
+	counter.Add(2.5, "bind", OUTCOME_FAILED)
+	counter.Inc(`quote " and \ back`+"\n", OUTCOME_FAILED)
+
+	expected := `# HELP test_total A test counter.
+# TYPE test_total counter
+test_total{operation="bind",outcome="failed"} 2.5
+test_total{operation="provision",outcome="succeeded"} 2
+test_total{operation="quote \" and \\ back\n",outcome="failed"} 1
+`
+	var buffer bytes.Buffer
+	counter.Write(&buffer)
+	if buffer.String() != expected {
+		t.Errorf("counter is written as\n%s\nwant\n%s", buffer.String(), expected)
+	}
+}
+
+func TestCounterVecWithoutLabels(t *testing.T) {
+	counter := NewCounterVec("plain_total", "No labels.")
+	counter.Inc()
+
+	expected := "# HELP plain_total No labels.\n# TYPE plain_total counter\nplain_total 1\n"
+	var buffer bytes.Buffer
+	counter.Write(&buffer)
+	if buffer.String() != expected {
+		t.Errorf("counter is written as\n%s\nwant\n%s", buffer.String(), expected)
+	}
+}
+
+func TestHistogramVecWrite(t *testing.T) {
+	histogram := NewHistogramVec("test_seconds", "A test histogram.", []float64{0.1, 1}, "route")
+	histogram.Observe(0.05, "catalog")
+	histogram.Observe(0.5, "catalog")
+	histogram.Observe(2, "catalog")
+
+	expected := `# HELP test_seconds A test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{route="catalog",le="0.1"} 1
+test_seconds_bucket{route="catalog",le="1"} 2
+test_seconds_bucket{route="catalog",le="+Inf"} 3
+test_seconds_sum{route="catalog"} 2.55
+test_seconds_count{route="catalog"} 3
+`
+	var buffer bytes.Buffer
+	histogram.Write(&buffer)
+	if buffer.String() != expected {
+		t.Errorf("histogram is written as\n%s\nwant\n%s", buffer.String(), expected)
+	}
+}
+
+func TestGaugeFuncWrite(t *testing.T) {
+	gauge := NewGaugeFunc("test_instances", "A test gauge.", func() []GaugeValue {
+		return []GaugeValue{
+			{LabelValues: []string{"small"}, Value: 3},
+			{LabelValues: []string{"large"}, Value: 0},
+		}
+	}, "plan")
+
+	expected := `# HELP test_instances A test gauge.
+# TYPE test_instances gauge
+test_instances{plan="small"} 3
+test_instances{plan="large"} 0
+`
+	var buffer bytes.Buffer
+	gauge.Write(&buffer)
+	if buffer.String() != expected {
+		t.Errorf("gauge is written as\n%s\nwant\n%s", buffer.String(), expected)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("status is %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4" {
+		t.Errorf("content type is %q", contentType)
+	}
+	for _, name := range []string{"broker_http_requests_total", "broker_http_request_duration_seconds", "broker_operations_total"} {
+		if !strings.Contains(recorder.Body.String(), "# TYPE "+name+" ") {
+			t.Errorf("%s is not served", name)
+		}
+	}
+}
+
+func TestOutcomes(t *testing.T) {
+	if outcome := Outcome(nil); outcome != OUTCOME_SUCCEEDED {
+		t.Errorf("Outcome(nil) = %s", outcome)
+	}
+	if outcome := Outcome(errors.New("failed")); outcome != OUTCOME_FAILED {
+		t.Errorf("Outcome(err) = %s", outcome)
+	}
+
+	tests := []struct {
+		status  int
+		outcome string
+	}{
+		{http.StatusOK, OUTCOME_SUCCEEDED},
+		{http.StatusCreated, OUTCOME_SUCCEEDED},
+		{http.StatusAccepted, OUTCOME_ACCEPTED},
+		{http.StatusGone, OUTCOME_FAILED},
+		{http.StatusInternalServerError, OUTCOME_FAILED},
+	}
+	for _, test := range tests {
+		if outcome := StatusOutcome(test.status); outcome != test.outcome {
+			t.Errorf("StatusOutcome(%d) = %s, want %s", test.status, outcome, test.outcome)
+		}
+	}
+}
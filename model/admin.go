@@ -0,0 +1,70 @@
+package model
+
+// InstanceSummary is a service instance as listed by the admin API, along
+// with its usage of the backend server.
+type InstanceSummary struct {
+	*ServiceInstance
+
+	State       string `json:"state"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Connections int    `json:"connections"`
+	Bindings    int    `json:"bindings"`
+}
+
+// InstanceDetail is a service instance as shown by the admin API. It never
+// carries the password of the instance.
+type InstanceDetail struct {
+	InstanceSummary
+
+	Username    string            `json:"username,omitempty"`
+	RequireSSL  bool              `json:"require_ssl,omitempty"`
+	BindingList []*ServiceBinding `json:"binding_list"`
+	Suspension  *Suspension       `json:"suspension,omitempty"`
+}
+
+// InstanceFilter selects service instances by the fields that are set.
+type InstanceFilter struct {
+	OrganizationGuid string
+	SpaceGuid        string
+	PlanId           string
+	Server           string
+	State            string
+}
+
+// MatchesInstance reports whether instance matches the organization, space
+// and plan of the filter.
+func (f InstanceFilter) MatchesInstance(instance *ServiceInstance) bool {
+	return (f.OrganizationGuid == "" || f.OrganizationGuid == instance.OrganizationGuid) &&
+		(f.SpaceGuid == "" || f.SpaceGuid == instance.SpaceGuid) &&
+		(f.PlanId == "" || f.PlanId == instance.PlanId)
+}
+
+// Matches reports whether summary matches all fields of the filter.
+func (f InstanceFilter) Matches(summary *InstanceSummary) bool {
+	return f.MatchesInstance(summary.ServiceInstance) &&
+		(f.Server == "" || f.Server == summary.Server) &&
+		(f.State == "" || f.State == summary.State)
+}
+
+// ResyncReport tells what the broker found on the backend server for an
+// instance and, if Repaired is set, what it repaired.
+type ResyncReport struct {
+	InstanceId     string   `json:"instance_id"`
+	Database       string   `json:"database"`
+	DatabaseExists bool     `json:"database_exists"`
+	Username       string   `json:"username,omitempty"`
+	UserExists     bool     `json:"user_exists"`
+	Repaired       bool     `json:"repaired"`
+	Actions        []string `json:"actions"`
+}
+
+// ReconcileReport compares all service instances with the backend server.
+// Orphan databases are broker databases that no instance refers to.
+type ReconcileReport struct {
+	Instances       []*ResyncReport `json:"instances"`
+	OrphanDatabases []string        `json:"orphan_databases"`
+}
+
+type ForceDeleteRequest struct {
+	Confirm bool `json:"confirm"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+)
+
+// AuditEvent records who asked the broker to change what, and how it went.
+// Parameters are redacted before the event is recorded.
+type AuditEvent struct {
+	Id                  string               `json:"id"`
+	Time                time.Time            `json:"time"`
+	RequestId           string               `json:"request_id,omitempty"`
+	Operation           string               `json:"operation"`
+	InstanceId          string               `json:"instance_id,omitempty"`
+	BindingId           string               `json:"binding_id,omitempty"`
+	BackupId            string               `json:"backup_id,omitempty"`
+	BrokerUser          string               `json:"broker_user,omitempty"`
+	OriginatingIdentity *OriginatingIdentity `json:"originating_identity,omitempty"`
+	Parameters          interface{}          `json:"parameters,omitempty"`
+	Status              int                  `json:"status"`
+	Outcome             string               `json:"outcome"`
+	Error               string               `json:"error,omitempty"`
+	DurationMs          int64                `json:"duration_ms"`
+}
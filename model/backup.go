@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	BACKUP_STATE_IN_PROGRESS = "in progress"
+	BACKUP_STATE_SUCCEEDED   = "succeeded"
+	BACKUP_STATE_FAILED      = "failed"
+
+	BACKUP_KIND_MANUAL    = "manual"
+	BACKUP_KIND_SCHEDULED = "scheduled"
+	BACKUP_KIND_FINAL     = "final"
+)
+
+type Backup struct {
+	Id         string     `json:"id"`
+	InstanceId string     `json:"instance_id"`
+	Database   string     `json:"database"`
+	Kind       string     `json:"kind"`
+	Target     string     `json:"target"`
+	Location   string     `json:"location"`
+	State      string     `json:"state"`
+	Error      string     `json:"error,omitempty"`
+	Size       int64      `json:"size"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type RestoreRequest struct {
+	BackupId string `json:"backup_id"`
+	Confirm  bool   `json:"confirm"`
+}
+
+// BackupScheduleStatus is the outcome of the latest scheduled backup of an
+// instance, kept so that failing schedules show up in the admin API.
+type BackupScheduleStatus struct {
+	InstanceId          string    `json:"instance_id"`
+	PlanId              string    `json:"plan_id"`
+	Schedule            string    `json:"schedule"`
+	LastRun             time.Time `json:"last_run"`
+	LastBackupId        string    `json:"last_backup_id"`
+	LastState           string    `json:"last_state"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
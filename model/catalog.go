@@ -1,5 +1,44 @@
 package model
 
+import (
+	"errors"
+	"fmt"
+)
+
 type Catalog struct {
 	Services []Service `json:"services"`
 }
+
+// Validate checks that the catalog has at least one service, that services
+// and plans have a name and an id, and that ids are unique.
+func (c *Catalog) Validate() error {
+	if len(c.Services) == 0 {
+		return errors.New("catalog has no services")
+	}
+
+	ids := make(map[string]bool)
+	for i, service := range c.Services {
+		if service.Id == "" || service.Name == "" {
+			return errors.New(fmt.Sprintf("service #%d has no id or name", i))
+		}
+		if ids[service.Id] {
+			return errors.New(fmt.Sprintf("duplicate id %s", service.Id))
+		}
+		ids[service.Id] = true
+
+		if len(service.Plans) == 0 {
+			return errors.New(fmt.Sprintf("service %s has no plans", service.Name))
+		}
+		for j, plan := range service.Plans {
+			if plan.Id == "" || plan.Name == "" {
+				return errors.New(fmt.Sprintf("plan #%d of service %s has no id or name", j, service.Name))
+			}
+			if ids[plan.Id] {
+				return errors.New(fmt.Sprintf("duplicate id %s", plan.Id))
+			}
+			ids[plan.Id] = true
+		}
+	}
+
+	return nil
+}
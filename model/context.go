@@ -0,0 +1,38 @@
+package model
+
+const (
+	PLATFORM_CLOUDFOUNDRY = "cloudfoundry"
+	PLATFORM_KUBERNETES   = "kubernetes"
+)
+
+// Context is the platform context object sent along with provision, update
+// and bind requests. Cloud Foundry fills in the organization and space,
+// a Kubernetes service catalog fills in the namespace.
+type Context struct {
+	Platform         string `json:"platform"`
+	OrganizationGuid string `json:"organization_guid,omitempty"`
+	SpaceGuid        string `json:"space_guid,omitempty"`
+	Namespace        string `json:"namespace,omitempty"`
+	ClusterId        string `json:"clusterid,omitempty"`
+	InstanceName     string `json:"instance_name,omitempty"`
+}
+
+func (c *Context) Supported() bool {
+	return c.Platform == PLATFORM_CLOUDFOUNDRY || c.Platform == PLATFORM_KUBERNETES
+}
+
+// Tenant returns the space guid for Cloud Foundry and the namespace for
+// Kubernetes, or an empty string if the context carries neither.
+func (c *Context) Tenant() string {
+	if c == nil {
+		return ""
+	}
+
+	switch c.Platform {
+	case PLATFORM_CLOUDFOUNDRY:
+		return c.SpaceGuid
+	case PLATFORM_KUBERNETES:
+		return c.Namespace
+	}
+	return ""
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	CREDENTIAL_FORMAT_JDBC   = "jdbc"
+	CREDENTIAL_FORMAT_DSN    = "dsn"
+	CREDENTIAL_FORMAT_MYSQL2 = "mysql2"
+	CREDENTIAL_FORMAT_ENV    = "env"
+)
+
+var credentialFormats = []string{
+	CREDENTIAL_FORMAT_JDBC,
+	CREDENTIAL_FORMAT_DSN,
+	CREDENTIAL_FORMAT_MYSQL2,
+	CREDENTIAL_FORMAT_ENV,
+}
+
+// ValidateCredentialFormats checks that every format is one of jdbc, dsn,
+// mysql2 or env.
+func ValidateCredentialFormats(formats []string) error {
+	for _, format := range formats {
+		known := false
+		for _, f := range credentialFormats {
+			if format == f {
+				known = true
+			}
+		}
+		if !known {
+			return errors.New(fmt.Sprintf("unknown credential format %q, expected one of %v", format, credentialFormats))
+		}
+	}
+	return nil
+}
+
+// WithFormats returns a copy of c with the connection strings of the given
+// formats filled in:
+//
+//	jdbc    jdbcUrl, for JDBC drivers
+//	dsn     dsn, for github.com/go-sql-driver/mysql
+//	mysql2  mysql2Url, for the mysql2 gem and ActiveRecord's DATABASE_URL
+//	env     env, environment variables carrying all of the above
+func (c *Credential) WithFormats(formats []string) *Credential {
+	copied := *c
+	for _, format := range formats {
+		switch format {
+		case CREDENTIAL_FORMAT_JDBC:
+			copied.JdbcUrl = c.jdbcUrl()
+		case CREDENTIAL_FORMAT_DSN:
+			copied.Dsn = c.dsn()
+		case CREDENTIAL_FORMAT_MYSQL2:
+			copied.Mysql2Url = c.mysql2Url()
+		case CREDENTIAL_FORMAT_ENV:
+			copied.Env = c.env()
+		}
+	}
+	return &copied
+}
+
+// WithEndpoint returns a copy of c for reaching the database on host and
+// port.
+func (c *Credential) WithEndpoint(host string, port int) *Credential {
+	copied := *c
+	copied.Host = host
+	copied.Port = port
+	copied.Uri = copied.BuildUri()
+	return &copied
+}
+
+// BuildUri returns the mysql:// URI of the credential.
+func (c *Credential) BuildUri() string {
+	uri := fmt.Sprintf("mysql://%s:%s@%s/%s", c.Username, c.Password, c.address(), c.Database)
+	if c.RequireSSL {
+		uri += "?ssl-mode=REQUIRED"
+	}
+	return uri
+}
+
+// Private methods
+
+func (c *Credential) address() string {
+	return c.Host + ":" + strconv.Itoa(c.Port)
+}
+
+func (c *Credential) jdbcUrl() string {
+	query := url.Values{}
+	query.Set("user", c.Username)
+	query.Set("password", c.Password)
+	if c.RequireSSL {
+		query.Set("useSSL", "true")
+		query.Set("requireSSL", "true")
+	}
+	return fmt.Sprintf("jdbc:mysql://%s/%s?%s", c.address(), c.Database, query.Encode())
+}
+
+func (c *Credential) dsn() string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s", c.Username, c.Password, c.address(), c.Database)
+	if c.RequireSSL {
+		dsn += "?tls=true"
+	}
+	return dsn
+}
+
+func (c *Credential) mysql2Url() string {
+	u := url.URL{
+		Scheme: "mysql2",
+		User:   url.UserPassword(c.Username, c.Password),
+		Host:   c.address(),
+		Path:   "/" + c.Database,
+	}
+	if c.RequireSSL {
+		u.RawQuery = "ssl_mode=required"
+	}
+	return u.String()
+}
+
+func (c *Credential) env() map[string]string {
+	env := map[string]string{
+		"MYSQL_HOST":        c.Host,
+		"MYSQL_PORT":        strconv.Itoa(c.Port),
+		"MYSQL_DATABASE":    c.Database,
+		"MYSQL_USER":        c.Username,
+		"MYSQL_PASSWORD":    c.Password,
+		"MYSQL_URI":         c.Uri,
+		"MYSQL_DSN":         c.dsn(),
+		"JDBC_DATABASE_URL": c.jdbcUrl(),
+		"DATABASE_URL":      c.mysql2Url(),
+	}
+	if c.RequireSSL {
+		env["MYSQL_SSL_MODE"] = "REQUIRED"
+	}
+	if c.CACertificate != "" {
+		env["MYSQL_SSL_CA"] = c.CACertificate
+	}
+	return env
+}
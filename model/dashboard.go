@@ -0,0 +1,31 @@
+package model
+
+type TableStats struct {
+	Name      string `json:"name"`
+	Engine    string `json:"engine"`
+	Rows      int64  `json:"rows"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// Connection is an open connection to the backend server.
+type Connection struct {
+	Id          int64  `json:"id"`
+	User        string `json:"user"`
+	Host        string `json:"host"`
+	Command     string `json:"command"`
+	TimeSeconds int64  `json:"time_seconds"`
+	State       string `json:"state"`
+}
+
+// Dashboard is what the dashboard of a service instance shows. Errors holds
+// what could not be read from the backend server.
+type Dashboard struct {
+	Instance    *ServiceInstance
+	State       string
+	SizeBytes   int64
+	Tables      []*TableStats
+	Connections []*Connection
+	Bindings    []*ServiceBinding
+	Operations  []*AuditEvent
+	Errors      []string
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+)
+
+// DeletedInstance is a deprovisioned service instance whose database is kept
+// under a different name until its grace period is over.
+type DeletedInstance struct {
+	Instance      *ServiceInstance  `json:"instance"`
+	Credential    *Credential       `json:"credential"`
+	Bindings      []*ServiceBinding `json:"bindings"`
+	Database      string            `json:"database"`
+	FinalBackupId string            `json:"final_backup_id,omitempty"`
+	DeletedAt     time.Time         `json:"deleted_at"`
+	PurgeAt       time.Time         `json:"purge_at"`
+}
+
+// DeletedInstanceDetail is a deleted instance as listed by the admin API. Like
+// InstanceDetail it never carries the password of the instance.
+type DeletedInstanceDetail struct {
+	Instance      *ServiceInstance  `json:"instance"`
+	Username      string            `json:"username,omitempty"`
+	RequireSSL    bool              `json:"require_ssl,omitempty"`
+	Bindings      []*ServiceBinding `json:"bindings"`
+	Database      string            `json:"database"`
+	FinalBackupId string            `json:"final_backup_id,omitempty"`
+	DeletedAt     time.Time         `json:"deleted_at"`
+	PurgeAt       time.Time         `json:"purge_at"`
+}
+
+// Detail returns d without its credential but for the username.
+func (d *DeletedInstance) Detail() *DeletedInstanceDetail {
+	detail := &DeletedInstanceDetail{
+		Instance:      d.Instance,
+		Bindings:      d.Bindings,
+		Database:      d.Database,
+		FinalBackupId: d.FinalBackupId,
+		DeletedAt:     d.DeletedAt,
+		PurgeAt:       d.PurgeAt,
+	}
+	if d.Credential != nil {
+		detail.Username = d.Credential.Username
+		detail.RequireSSL = d.Credential.RequireSSL
+	}
+	return detail
+}
@@ -0,0 +1,21 @@
+package model
+
+type OriginatingIdentity struct {
+	Platform string                 `json:"platform"`
+	Value    map[string]interface{} `json:"value"`
+}
+
+// User returns the identifier of the platform user who triggered the request:
+// the user_id for Cloud Foundry and the username for Kubernetes.
+func (o *OriginatingIdentity) User() string {
+	if o == nil {
+		return ""
+	}
+
+	for _, key := range []string{"user_id", "username"} {
+		if user, ok := o.Value[key].(string); ok {
+			return user
+		}
+	}
+	return ""
+}
@@ -0,0 +1,26 @@
+package model
+
+const (
+	QUOTA_SCOPE_ORGANIZATION = "organization"
+	QUOTA_SCOPE_SPACE        = "space"
+	QUOTA_SCOPE_NAMESPACE    = "namespace"
+
+	// Plan id of the limit on the instances of all plans together.
+	QUOTA_ALL_PLANS = "*"
+)
+
+// QuotaUsage is a quota policy along with how much of it a tenant uses.
+type QuotaUsage struct {
+	Scope string `json:"scope"`
+	Id    string `json:"id"`
+
+	Instances    []*PlanQuotaUsage `json:"instances"`
+	MaxStorageMB int64             `json:"max_storage_mb,omitempty"`
+	StorageBytes int64             `json:"storage_bytes"`
+}
+
+type PlanQuotaUsage struct {
+	PlanId string `json:"plan_id"`
+	Limit  int    `json:"limit"`
+	Used   int    `json:"used"`
+}
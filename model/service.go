@@ -9,6 +9,9 @@ type Service struct {
 	Tags           []string `json:"tags, omitempty"`
 	Requires       []string `json:"requires, omitempty"`
 
+	InstancesRetrievable bool `json:"instances_retrievable,omitempty"`
+	BindingsRetrievable  bool `json:"bindings_retrievable,omitempty"`
+
 	Metadata        interface{}   `json:"metadata, omitempty"`
 	Plans           []ServicePlan `json:"plans"`
 	DashboardClient interface{}   `json:"dashboard_client"`
@@ -7,6 +7,21 @@ type ServiceBinding struct {
 	ServicePlanId     string `json:"service_plan_id"`
 	PrivateKey        string `json:"private_key"`
 	ServiceInstanceId string `json:"service_instance_id"`
+
+	Parameters          interface{}          `json:"parameters,omitempty"`
+	Context             *Context             `json:"context,omitempty"`
+	OriginatingIdentity *OriginatingIdentity `json:"originating_identity,omitempty"`
+	CredentialFormats   []string             `json:"credential_formats,omitempty"`
+	Endpoint            string               `json:"endpoint,omitempty"`
+
+	// The app a bind request is for, AppId is taken from them.
+	AppGuid      string        `json:"app_guid,omitempty"`
+	BindResource *BindResource `json:"bind_resource,omitempty"`
+}
+
+type BindResource struct {
+	AppGuid string `json:"app_guid,omitempty"`
+	Route   string `json:"route,omitempty"`
 }
 
 type CreateServiceBindingResponse struct {
@@ -14,11 +29,27 @@ type CreateServiceBindingResponse struct {
 	Credentials interface{} `json:"credentials"`
 }
 
+type GetServiceBindingResponse struct {
+	Credentials interface{} `json:"credentials"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
 type Credential struct {
-	Uri      string `json:uri`
-	Username string `json:username`
-	Password string `json:password`
-	Host     string `json:host`
-	Port     int    `json:port`
-	Database string `json:database`
+	Uri      string `json:"uri"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Database string `json:"database"`
+
+	// Set for plans that require SSL connections.
+	RequireSSL    bool   `json:"require_ssl,omitempty"`
+	CACertificate string `json:"ca_certificate,omitempty"`
+
+	// Only filled in for the formats requested by a binding, see
+	// WithFormats.
+	JdbcUrl   string            `json:"jdbcUrl,omitempty"`
+	Dsn       string            `json:"dsn,omitempty"`
+	Mysql2Url string            `json:"mysql2Url,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
 }
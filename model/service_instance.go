@@ -1,5 +1,11 @@
 package model
 
+const (
+	LAST_OPERATION_IN_PROGRESS = "in progress"
+	LAST_OPERATION_SUCCEEDED   = "succeeded"
+	LAST_OPERATION_FAILED      = "failed"
+)
+
 type ServiceInstance struct {
 	Id               string `json:"id"`
 	DashboardUrl     string `json:"dashboard_url"`
@@ -10,8 +16,20 @@ type ServiceInstance struct {
 	SpaceGuid        string `json:"space_guid"`
 
 	LastOperation *LastOperation `json:"last_operation, omitempty"`
+	// Operation names the asynchronous operation the broker is running on
+	// the instance, if any.
+	Operation string `json:"operation,omitempty"`
+	// Server is the host:port address of the backend server holding the
+	// instance's database.
+	Server string `json:"server,omitempty"`
+	// Suspended instances keep their data but their user can not connect,
+	// see Suspension.
+	Suspended bool `json:"suspended,omitempty"`
 
 	Parameters interface{} `json:"parameters, omitempty"`
+
+	Context             *Context             `json:"context,omitempty"`
+	OriginatingIdentity *OriginatingIdentity `json:"originating_identity,omitempty"`
 }
 
 type LastOperation struct {
@@ -21,6 +39,21 @@ type LastOperation struct {
 }
 
 type CreateServiceInstanceResponse struct {
-	DashboardUrl  string         `json:"dashboard_url"`
+	DashboardUrl  string         `json:"dashboard_url,omitempty"`
 	LastOperation *LastOperation `json:"last_operation, omitempty"`
+	Operation     string         `json:"operation,omitempty"`
+}
+
+// UpdateServiceInstanceRequest is the body of an update request. The broker
+// only changes the plan of an instance.
+type UpdateServiceInstanceRequest struct {
+	ServiceId string `json:"service_id"`
+	PlanId    string `json:"plan_id,omitempty"`
+}
+
+type GetServiceInstanceResponse struct {
+	ServiceId    string      `json:"service_id"`
+	PlanId       string      `json:"plan_id"`
+	DashboardUrl string      `json:"dashboard_url,omitempty"`
+	Parameters   interface{} `json:"parameters,omitempty"`
 }
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+const STORE_EXPORT_VERSION = 1
+
+// StoreExport holds the whole broker store, as written by the store export
+// command and read by store import.
+type StoreExport struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+
+	Instances        map[string]*ServiceInstance `json:"instances"`
+	Bindings         map[string]*ServiceBinding  `json:"bindings"`
+	Credentials      map[string]*Credential      `json:"credentials"`
+	DeletedInstances map[string]*DeletedInstance `json:"deleted_instances"`
+	Suspensions      map[string]*Suspension      `json:"suspensions"`
+	Backups          []*Backup                   `json:"backups"`
+}
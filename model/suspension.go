@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	// The user was locked with ALTER USER ... ACCOUNT LOCK, its privileges
+	// were left alone.
+	SUSPEND_METHOD_ACCOUNT_LOCK = "account_lock"
+	// The server does not support account locking, the privileges of the
+	// user were revoked instead.
+	SUSPEND_METHOD_REVOKE = "revoke"
+)
+
+// Suspension records how the user of a suspended instance was locked out, so
+// that resuming the instance restores exactly what it had before.
+type Suspension struct {
+	InstanceId string `json:"instance_id"`
+	Username   string `json:"username"`
+	Method     string `json:"method"`
+	// Grants are the GRANT statements of the user before it was suspended.
+	Grants            []string  `json:"grants,omitempty"`
+	Reason            string    `json:"reason,omitempty"`
+	KilledConnections int       `json:"killed_connections"`
+	SuspendedAt       time.Time `json:"suspended_at"`
+}
+
+type SuspendRequest struct {
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	USAGE_STATE_CREATED = "CREATED"
+	USAGE_STATE_UPDATED = "UPDATED"
+	USAGE_STATE_DELETED = "DELETED"
+	// SAMPLE events record the size of an instance's database periodically.
+	USAGE_STATE_SAMPLE = "SAMPLE"
+)
+
+// UsageEvent records a change of a service instance that billing cares
+// about, shaped after Cloud Foundry's service usage events. The plan name,
+// free flag and cost are taken from the catalog when the event is recorded.
+type UsageEvent struct {
+	// Sequence numbers the events in the order they were recorded, starting
+	// at 1.
+	Sequence            int64       `json:"sequence"`
+	Guid                string      `json:"guid"`
+	CreatedAt           time.Time   `json:"created_at"`
+	State               string      `json:"state"`
+	ServiceInstanceGuid string      `json:"service_instance_guid"`
+	ServiceGuid         string      `json:"service_guid"`
+	ServicePlanGuid     string      `json:"service_plan_guid"`
+	ServicePlanName     string      `json:"service_plan_name,omitempty"`
+	PlanFree            bool        `json:"plan_free"`
+	PlanCost            interface{} `json:"plan_cost,omitempty"`
+	OrganizationGuid    string      `json:"organization_guid,omitempty"`
+	SpaceGuid           string      `json:"space_guid,omitempty"`
+	Namespace           string      `json:"namespace,omitempty"`
+	Suspended           bool        `json:"suspended"`
+	// SizeBytes is the size of the database when the event was recorded, if
+	// it could be read.
+	SizeBytes *int64 `json:"size_bytes,omitempty"`
+}
+
+// UsageEventPage is a page of usage events. NextUrl is empty on the last
+// page.
+type UsageEventPage struct {
+	TotalResults int           `json:"total_results"`
+	NextUrl      string        `json:"next_url,omitempty"`
+	Resources    []*UsageEvent `json:"resources"`
+}
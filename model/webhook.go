@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	WEBHOOK_EVENT_PROVISION   = "provision"
+	WEBHOOK_EVENT_DEPROVISION = "deprovision"
+	WEBHOOK_EVENT_BIND        = "bind"
+	WEBHOOK_EVENT_UNBIND      = "unbind"
+	// A failure event reports an operation that failed, Operation names it.
+	WEBHOOK_EVENT_FAILURE = "failure"
+)
+
+// WebhookEvent is the payload posted to webhook endpoints. Asynchronous
+// provisions are reported when they finish, so their events have no status.
+type WebhookEvent struct {
+	Id         string    `json:"id"`
+	Event      string    `json:"event"`
+	Operation  string    `json:"operation"`
+	Time       time.Time `json:"time"`
+	RequestId  string    `json:"request_id,omitempty"`
+	InstanceId string    `json:"instance_id"`
+	BindingId  string    `json:"binding_id,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// WebhookDeadLetter is an event that could not be delivered to an endpoint.
+type WebhookDeadLetter struct {
+	Url      string        `json:"url"`
+	Event    *WebhookEvent `json:"event"`
+	Attempts int           `json:"attempts"`
+	Error    string        `json:"error"`
+	FailedAt time.Time     `json:"failed_at"`
+}
@@ -0,0 +1,242 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+// The longest event the log reads back, longer lines are skipped.
+const MAX_EVENT_SIZE = 1024 * 1024
+
+// The log remembers where every INDEX_INTERVAL-th event starts, so After
+// reads at most that many events before the first one it returns.
+const INDEX_INTERVAL = 1000
+
+var ErrUnknownSequence = errors.New("no usage event has this sequence number")
+
+// Log stores usage events in a file, one JSON object per line, in the order
+// they were recorded. Every event gets the next sequence number, starting at
+// 1, and events are only ever appended, so a consumer can read them page by
+// page from the sequence number of the last event it has seen.
+type Log struct {
+	path string
+
+	lock sync.Mutex
+	file *os.File
+	// The sequence number of the last event and the size of the file up to
+	// its end.
+	last int64
+	size int64
+	// Where events start, in the order of their sequence numbers.
+	index []indexEntry
+}
+
+type indexEntry struct {
+	sequence int64
+	offset   int64
+}
+
+// Open opens the log at path, creating it if it does not exist, and reads it
+// once to index the events already recorded.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not open the usage log, message: %s", err.Error()))
+	}
+
+	l := &Log{path: path, file: file, index: []indexEntry{{sequence: 1, offset: 0}}}
+	if err := l.load(); err != nil {
+		file.Close()
+		return nil, errors.New(fmt.Sprintf("Could not read the usage log, message: %s", err.Error()))
+	}
+	return l, nil
+}
+
+// Append fills in the guid and time of event if they are missing, gives it
+// the next sequence number, writes it and syncs the file, so that an event
+// is not reported as recorded before it is on disk.
+func (l *Log) Append(event *model.UsageEvent) error {
+	if event.Guid == "" {
+		event.Guid = utils.GetGuid()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	event.Sequence = l.last + 1
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if _, writeErr := l.file.Write(line); writeErr != nil {
+		// Keep a partly written line from running into the next event.
+		if err := l.terminate(); err != nil {
+			return errors.New(fmt.Sprintf("%s, and could not end the line: %s", writeErr.Error(), err.Error()))
+		}
+		return writeErr
+	}
+
+	// Once written the event may be read back, even if syncing fails.
+	l.added(event.Sequence, l.size)
+	l.size += int64(len(line))
+	return l.file.Sync()
+}
+
+// After returns up to limit events recorded after the event with sequence
+// number after, oldest first, and how many events there are after it in
+// total. An after of 0 starts at the first event. Reading does not hold up
+// Append, events appended meanwhile show up on the next call.
+func (l *Log) After(after int64, limit int) ([]*model.UsageEvent, int, error) {
+	l.lock.Lock()
+	last, size := l.last, l.size
+	if after < 0 || after > last {
+		l.lock.Unlock()
+		return nil, 0, ErrUnknownSequence
+	}
+	i := sort.Search(len(l.index), func(i int) bool { return l.index[i].sequence > after+1 }) - 1
+	start := l.index[i]
+	l.lock.Unlock()
+
+	total := int(last - after)
+	if total == 0 {
+		return nil, 0, nil
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var events []*model.UsageEvent
+	// Stop at the size seen above, a line being appended may be incomplete.
+	section := io.NewSectionReader(file, start.offset, size-start.offset)
+	err = scanEvents(section, start, func(event *model.UsageEvent, offset int64) bool {
+		if event.Sequence > after {
+			events = append(events, event)
+		}
+		return limit <= 0 || len(events) < limit
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.file.Close()
+}
+
+// Private methods
+
+// load indexes the events in the file.
+func (l *Log) load() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	l.size = info.Size()
+
+	section := io.NewSectionReader(l.file, 0, l.size)
+	err = scanEvents(section, l.index[0], func(event *model.UsageEvent, offset int64) bool {
+		l.added(event.Sequence, offset)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return l.terminate()
+}
+
+// terminate ends the file with a newline if a crash or a failed write left
+// its last line cut short, so that the next event starts on a line of its
+// own. Must be called with l.lock held, or before the log is shared.
+func (l *Log) terminate() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	l.size = info.Size()
+	if l.size == 0 {
+		return nil
+	}
+
+	lastByte := make([]byte, 1)
+	if _, err := l.file.ReadAt(lastByte, l.size-1); err != nil {
+		return err
+	}
+	if lastByte[0] == '\n' {
+		return nil
+	}
+	if _, err := l.file.Write([]byte{'\n'}); err != nil {
+		return err
+	}
+	l.size++
+	return nil
+}
+
+// added records that the event with sequence starts at offset. Must be
+// called with l.lock held, or before the log is shared.
+func (l *Log) added(sequence, offset int64) {
+	l.last = sequence
+	if sequence%INDEX_INTERVAL == 1 && sequence > l.index[len(l.index)-1].sequence {
+		l.index = append(l.index, indexEntry{sequence: sequence, offset: offset})
+	}
+}
+
+// scanEvents decodes the events read from r, which starts at start, and
+// calls f with each of them and the offset it starts at until f returns
+// false. Events written before sequence numbers were recorded are numbered
+// by their position.
+func scanEvents(r io.Reader, start indexEntry, f func(event *model.UsageEvent, offset int64) bool) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	offset := start.offset
+	previous := start.sequence - 1
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && len(line) <= MAX_EVENT_SIZE {
+			var event model.UsageEvent
+			// A line cut short by a crash does not decode, the events after
+			// it are intact.
+			if json.Unmarshal(line, &event) == nil {
+				if event.Sequence == 0 {
+					event.Sequence = previous + 1
+				}
+				previous = event.Sequence
+				if !f(&event, offset) {
+					return nil
+				}
+			}
+		}
+		offset += int64(len(line))
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package usage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+func TestAfter(t *testing.T) {
+	log, path, cleanup := openTestLog(t, "")
+	defer cleanup()
+
+	count := 2*INDEX_INTERVAL + 10
+	for i := 1; i <= count; i++ {
+		if err := log.Append(&model.UsageEvent{ServiceInstanceGuid: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		after        int64
+		limit        int
+		first, total int
+		length       int
+	}{
+		{0, 10, 1, count, 10},
+		{5, 10, 6, count - 5, 10},
+		// Pages starting around and past the indexed events.
+		{INDEX_INTERVAL - 1, 3, INDEX_INTERVAL, count - INDEX_INTERVAL + 1, 3},
+		{INDEX_INTERVAL, 3, INDEX_INTERVAL + 1, count - INDEX_INTERVAL, 3},
+		{2*INDEX_INTERVAL + 5, 10, 2*INDEX_INTERVAL + 6, 5, 5},
+		{int64(count), 10, 0, 0, 0},
+	}
+
+	check := func(log *Log) {
+		for _, test := range tests {
+			events, total, err := log.After(test.after, test.limit)
+			if err != nil {
+				t.Errorf("after %d: %s", test.after, err)
+				continue
+			}
+			if total != test.total || len(events) != test.length {
+				t.Errorf("after %d: %d of %d events, want %d of %d", test.after, len(events), total, test.length, test.total)
+				continue
+			}
+			for i, event := range events {
+				sequence := int64(test.first + i)
+				if event.Sequence != sequence || event.ServiceInstanceGuid != strconv.Itoa(test.first+i) {
+					t.Errorf("after %d: event %d is %d %s, want %d", test.after, i, event.Sequence, event.ServiceInstanceGuid, sequence)
+				}
+			}
+		}
+
+		for _, after := range []int64{-1, int64(count) + 1} {
+			if _, _, err := log.After(after, 10); err != ErrUnknownSequence {
+				t.Errorf("after %d: error = %v, want %v", after, err, ErrUnknownSequence)
+			}
+		}
+	}
+
+	check(log)
+
+	// A reopened log indexes the file again and goes on numbering.
+	log.Close()
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	check(reopened)
+
+	event := &model.UsageEvent{}
+	if err := reopened.Append(event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Sequence != int64(count)+1 {
+		t.Errorf("appended event has sequence %d, want %d", event.Sequence, count+1)
+	}
+}
+
+func TestOpenDamagedLog(t *testing.T) {
+	// Events recorded before sequence numbers, a line cut short by a crash
+	// in the middle and one at the end.
+	content := `{"guid":"a"}
+{"guid":"b"}
+{"guid":"c","sta
+{"guid":"d"}
+{"guid":"e","state":"CRE`
+
+	log, _, cleanup := openTestLog(t, content)
+	defer cleanup()
+
+	event := &model.UsageEvent{Guid: "f"}
+	if err := log.Append(event); err != nil {
+		t.Fatal(err)
+	}
+
+	events, total, err := log.After(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(events) != 3 {
+		t.Fatalf("%d of %d events, want 3 of 3", len(events), total)
+	}
+	for i, guid := range []string{"b", "d", "f"} {
+		if events[i].Guid != guid || events[i].Sequence != int64(i+2) {
+			t.Errorf("event %d is %d %s, want %d %s", i, events[i].Sequence, events[i].Guid, i+2, guid)
+		}
+	}
+}
+
+// openTestLog opens a log in a new temporary directory, holding content
+// already, and returns it, its path and a function removing the directory.
+func openTestLog(t *testing.T, content string) (*Log, string, func()) {
+	dir, err := ioutil.TempDir("", "usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, "UsageEvents.jsonl")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	log, err := Open(path)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return log, path, cleanup
+}
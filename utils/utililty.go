@@ -9,7 +9,7 @@ import (
 
 	"encoding/base64"
 	"github.com/gorilla/mux"
-	"log"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
 	"regexp"
 	"strings"
 
@@ -18,10 +18,14 @@ import (
 	"encoding/hex"
 	"io"
 )
-const encodeStd = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789ac"
+
+// Uids go into database and user names, so they only use letters and digits.
+const uidAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+const uidLength = 12
+
 var (
 	REG_BASIC_AUTH = regexp.MustCompile(`^Basic (.+)$`)
-	URLEncoding = base64.NewEncoding(encodeStd)
 )
 
 func ReadAndUnmarshal(object interface{}, dir string, fileName string) error {
@@ -41,7 +45,7 @@ func ReadAndUnmarshal(object interface{}, dir string, fileName string) error {
 }
 
 func MarshalAndRecord(object interface{}, dir, fileName string) error {
-	log.Println(object, dir, fileName)
+	logger.Debug("recording data file", "dir", dir, "file", fileName)
 	MkDir(dir)
 	path := dir + string(os.PathSeparator) + fileName
 
@@ -61,7 +65,7 @@ func WriteResponse(w http.ResponseWriter, code int, object interface{}) {
 	}
 
 	w.WriteHeader(code)
-	fmt.Fprintf(w, string(data))
+	w.Write(data)
 }
 
 func ProvisionDataFromRequest(r *http.Request, object interface{}) error {
@@ -178,18 +182,40 @@ func GetGuid() string {
 	if _, err := io.ReadFull(rand.Reader, b); err != nil {
 		return ""
 	}
-	return GetMd5String(URLEncoding.EncodeToString(b))
-}
-
-func base64Encode(src []byte) string {
-	return URLEncoding.EncodeToString(src)
+	return GetMd5String(base64.URLEncoding.EncodeToString(b))
 }
 
 func GetUid() string {
+	uid := make([]byte, 0, uidLength)
 	b := make([]byte, 48)
 
-	if _, err := io.ReadFull(rand.Reader, b); err != nil {
-		return ""
+	for len(uid) < uidLength {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return ""
+		}
+		for _, c := range b {
+			// Skip the bytes past the last whole multiple of the alphabet so
+			// that every character is equally likely.
+			if int(c) >= 256/len(uidAlphabet)*len(uidAlphabet) {
+				continue
+			}
+			uid = append(uid, uidAlphabet[int(c)%len(uidAlphabet)])
+			if len(uid) == uidLength {
+				break
+			}
+		}
+	}
+	return string(uid)
+}
+
+// GetStringParameter returns the string value of key in the arbitrary
+// parameters of a provision or bind request.
+func GetStringParameter(parameters interface{}, key string) (string, bool) {
+	m, ok := parameters.(map[string]interface{})
+	if !ok {
+		return "", false
 	}
-	return base64Encode(b)[:12]
+
+	value, ok := m[key].(string)
+	return value, ok
 }
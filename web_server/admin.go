@@ -0,0 +1,200 @@
+package web_server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/backup"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+// adminHandler only lets requests through that carry the operator credentials
+// from the admin_username and admin_password settings, or a verified client
+// certificate whose common name is one of the tls admin_client_names.
+func adminHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if adminClientCertificate(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, password, err := utils.ParseBasicAuth(r)
+		if err != nil || !adminCredentialsMatch(user, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Unauthorized"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminListInstances lists the service instances matching the
+// organization_guid, space_guid, plan_id, server and state query parameters,
+// with the size of their databases and their number of open connections.
+func (c *Controller) AdminListInstances(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin list service instances")
+
+	utils.WriteResponse(w, http.StatusOK, c.ListInstances(log, instanceFilter(r.URL.Query())))
+}
+
+func (c *Controller) AdminGetInstance(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin get service instance")
+
+	detail := c.InstanceDetail(log, utils.ExtractVarsFromRequest(r, "service_instance_guid"))
+	if detail == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusOK, detail)
+}
+
+// AdminListBindings lists the service bindings matching the instance_id,
+// organization_guid, space_guid and plan_id query parameters. Bindings do not
+// carry credentials, those are fetched through the broker API.
+func (c *Controller) AdminListBindings(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin list service bindings")
+
+	query := r.URL.Query()
+	utils.WriteResponse(w, http.StatusOK, c.ListBindings(query.Get("instance_id"), instanceFilter(query)))
+}
+
+func (c *Controller) AdminListBackups(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin list backups")
+
+	instanceId := utils.ExtractVarsFromRequest(r, "service_instance_guid")
+	if instanceId == "" {
+		instanceId = r.URL.Query().Get("instance_id")
+	}
+
+	utils.WriteResponse(w, http.StatusOK, c.ListBackups(instanceId))
+}
+
+func (c *Controller) AdminCreateBackup(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin create backup")
+
+	result, err := c.CreateBackup(utils.ExtractVarsFromRequest(r, "service_instance_guid"))
+	if err == ErrInstanceNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusCreated, result)
+}
+
+// AdminRestoreBackup replaces the data of an instance with a backup, which
+// may have been taken from another instance. It requires "confirm": true in
+// the request body since the current data of the instance is dropped.
+func (c *Controller) AdminRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin restore backup")
+
+	var request model.RestoreRequest
+	if err := utils.ProvisionDataFromRequest(r, &request); err != nil {
+		writeBrokerError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !request.Confirm {
+		writeBrokerError(w, http.StatusUnprocessableEntity, errors.New("restore drops the current data of the instance, set \"confirm\": true to proceed"))
+		return
+	}
+
+	err := c.RestoreBackup(request.BackupId, utils.ExtractVarsFromRequest(r, "service_instance_guid"))
+	if err == ErrInstanceNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err == backup.ErrBackupNotFound {
+		writeBrokerError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusOK, "{}")
+}
+
+func (c *Controller) AdminGetBackup(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin get backup")
+
+	result, err := c.backups.Get(utils.ExtractVarsFromRequest(r, "backup_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusOK, result)
+}
+
+func (c *Controller) AdminDeleteBackup(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin delete backup")
+
+	err := c.backups.Delete(utils.ExtractVarsFromRequest(r, "backup_id"))
+	if err == backup.ErrBackupNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeBrokerError(w, http.StatusConflict, err)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusOK, "{}")
+}
+
+func (c *Controller) AdminBackupSchedules(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin backup schedules")
+
+	utils.WriteResponse(w, http.StatusOK, c.backupScheduler.Status())
+}
+
+// Private methods
+
+func instanceFilter(query url.Values) model.InstanceFilter {
+	return model.InstanceFilter{
+		OrganizationGuid: query.Get("organization_guid"),
+		SpaceGuid:        query.Get("space_guid"),
+		PlanId:           query.Get("plan_id"),
+		Server:           query.Get("server"),
+		State:            query.Get("state"),
+	}
+}
+
+func adminCredentialsMatch(user, password string) bool {
+	if conf.AdminUsername == "" || conf.AdminPassword == "" {
+		return false
+	}
+
+	userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(conf.AdminUsername))
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(conf.AdminPassword))
+	return userMatch&passwordMatch == 1
+}
+
+func adminClientCertificate(r *http.Request) bool {
+	name := clientCertificateName(r)
+	if name == "" {
+		return false
+	}
+
+	for _, allowed := range conf.TLS.AdminClientNames {
+		if name == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package web_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/audit"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/metrics"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	// Larger request bodies are not recorded as parameters.
+	MAX_AUDITED_BODY_SIZE = 64 * 1024
+	// At most this much of an error response is kept for its description.
+	MAX_AUDITED_ERROR_SIZE = 4 * 1024
+
+	DEFAULT_AUDIT_QUERY_LIMIT   = 100
+	DEFAULT_AUDIT_LOG_FILE_NAME = "AuditLog.jsonl"
+)
+
+// Routes whose requests are recorded in the audit log, by route name, with
+// the operation they are recorded as.
+var auditedRoutes = map[string]string{
+	"provision":           "provision",
+	"update":              "update",
+	"deprovision":         "deprovision",
+	"bind":                "bind",
+	"unbind":              "unbind",
+	"admin_create_backup": "backup",
+	"admin_restore":       "restore",
+	"admin_delete_backup": "delete_backup",
+	"admin_undelete":      "undelete",
+	"admin_purge":         "purge",
+
+	"admin_rotate_credentials": "rotate_credentials",
+	"admin_resync":             "resync",
+	"admin_force_delete":       "force_delete",
+	"admin_suspend":            "suspend",
+	"admin_resume":             "resume",
+	// Manifests carry the credentials of a binding.
+	"admin_binding_manifest": "export_binding",
+}
+
+type auditRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+}
+
+func (r *auditRecorder) Write(b []byte) (int, error) {
+	n, err := r.statusRecorder.Write(b)
+	if r.status >= 400 && r.body.Len() < MAX_AUDITED_ERROR_SIZE {
+		r.body.Write(b[:n])
+	}
+	return n, err
+}
+
+// auditHandler records an audit event for every request to one of the
+// audited routes of router once next has handled it. It must run after the
+// handlers that decode the originating identity and the request id.
+func auditHandler(router *mux.Router, log *audit.Log, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+		if !router.Match(r, &match) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := match.Route.GetName()
+		operation, ok := auditedRoutes[route]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		event := &model.AuditEvent{
+			RequestId:           requestIdFromRequest(r),
+			Operation:           operation,
+			InstanceId:          match.Vars["service_instance_guid"],
+			BindingId:           match.Vars["service_binding_guid"],
+			BackupId:            match.Vars["backup_id"],
+			OriginatingIdentity: originatingIdentityFromRequest(r),
+			Parameters:          auditedParameters(r, strings.HasPrefix(route, "admin_")),
+		}
+		event.BrokerUser, _, _ = utils.ParseBasicAuth(r)
+		if event.BrokerUser == "" {
+			event.BrokerUser = clientCertificateName(r)
+		}
+		if backupId, ok := utils.GetStringParameter(event.Parameters, "backup_id"); ok && event.BackupId == "" {
+			event.BackupId = backupId
+		}
+
+		recorder := &auditRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		event.Status = recorder.status
+		event.Outcome = metrics.StatusOutcome(recorder.status)
+		event.DurationMs = time.Since(start).Nanoseconds() / int64(time.Millisecond)
+		if recorder.status >= 400 {
+			event.Error = errorDescription(recorder.body.Bytes())
+		}
+		log.Record(event)
+	})
+}
+
+// AdminListAuditEvents returns the audit events matching the operation,
+// instance_id, binding_id, outcome, since, until and limit query parameters,
+// newest first.
+func (c *Controller) AdminListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin list audit events")
+
+	filter, err := auditFilterFromRequest(r)
+	if err != nil {
+		writeBrokerError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	events, err := c.audit.Query(filter)
+	if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if events == nil {
+		events = []*model.AuditEvent{}
+	}
+
+	utils.WriteResponse(w, http.StatusOK, events)
+}
+
+// Private methods
+
+// auditedParameters returns the parameters of a request, or its whole body
+// for admin requests, leaving the body intact for the handler.
+func auditedParameters(r *http.Request, wholeBody bool) interface{} {
+	if r.Body == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MAX_AUDITED_BODY_SIZE+1))
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil || len(body) == 0 || len(body) > MAX_AUDITED_BODY_SIZE {
+		return nil
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil
+	}
+	if wholeBody {
+		return decoded
+	}
+	return decoded["parameters"]
+}
+
+func errorDescription(body []byte) string {
+	var brokerError struct {
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(body, &brokerError); err == nil && brokerError.Description != "" {
+		return logger.Redact(brokerError.Description)
+	}
+	return logger.Redact(strings.TrimSpace(string(body)))
+}
+
+func auditFilterFromRequest(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Operation:  query.Get("operation"),
+		InstanceId: query.Get("instance_id"),
+		BindingId:  query.Get("binding_id"),
+		Outcome:    query.Get("outcome"),
+		Limit:      DEFAULT_AUDIT_QUERY_LIMIT,
+	}
+
+	var err error
+	if since := query.Get("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return filter, errors.New(fmt.Sprintf("Invalid since: %s", err.Error()))
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return filter, errors.New(fmt.Sprintf("Invalid until: %s", err.Error()))
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			return filter, errors.New(fmt.Sprintf("Invalid limit: %s", limit))
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,138 @@
+package web_server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/backup"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/metrics"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	CLONE_FROM_PARAMETER = "clone_from"
+	// The host:port of the server to clone onto. Only the backend server the
+	// broker is connected to is supported.
+	CLONE_SERVER_PARAMETER = "clone_server"
+
+	OPERATION_CLONE = "clone"
+)
+
+// cloneSource returns the instance to clone from, which must belong to the
+// same Cloud Foundry organization or Kubernetes namespace as instance. The
+// clone reads and writes through the admin pool of the backend server, so
+// the source must live on that server and so does the clone. Must be called
+// with c.lock held.
+func (c *Controller) cloneSource(instance *model.ServiceInstance, sourceId string) (*model.ServiceInstance, error) {
+	if server, ok := utils.GetStringParameter(instance.Parameters, CLONE_SERVER_PARAMETER); ok && server != client.Address() {
+		return nil, errors.New(fmt.Sprintf("Invalid %s: cloning onto server %s is not supported, clones are created on %s", CLONE_SERVER_PARAMETER, server, client.Address()))
+	}
+
+	source, ok := c.instanceMap[sourceId]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Invalid %s: service instance %s does not exist", CLONE_FROM_PARAMETER, sourceId))
+	}
+	if source.Server != "" && source.Server != client.Address() {
+		return nil, errors.New(fmt.Sprintf("Invalid %s: service instance %s is on server %s, cloning from another server than %s is not supported", CLONE_FROM_PARAMETER, sourceId, source.Server, client.Address()))
+	}
+	if source.Operation != "" {
+		return nil, errors.New(fmt.Sprintf("Invalid %s: service instance %s has an operation in progress", CLONE_FROM_PARAMETER, sourceId))
+	}
+
+	if source.OrganizationGuid != instance.OrganizationGuid || !sameNamespace(source.Context, instance.Context) {
+		return nil, errors.New(fmt.Sprintf("Invalid %s: service instance %s belongs to another tenant", CLONE_FROM_PARAMETER, sourceId))
+	}
+
+	return source, nil
+}
+
+// startClone copies the data of source into the database of the instance in
+// the background, reporting progress through the instance's last operation.
+func (c *Controller) startClone(log *logger.Logger, instanceId string, source *model.ServiceInstance, database string) {
+	sourceId, sourceDatabase := source.Id, source.InternalId
+	log = log.With("instance_id", instanceId, "source_instance_id", sourceId)
+
+	c.jobs.Add(1)
+	go func() {
+		defer c.jobs.Done()
+
+		log.Info("clone started")
+		err := backup.Clone(client.DB, sourceDatabase, client.DB, database, func(done, total int) {
+			c.setLastOperation(instanceId, model.LAST_OPERATION_IN_PROGRESS,
+				fmt.Sprintf("cloning service instance %s: %d of %d tables copied", sourceId, done, total), false)
+		})
+
+		metrics.Operations.Inc(OPERATION_CLONE, metrics.Outcome(err))
+		c.notifyAsyncProvision(instanceId, err)
+		if err != nil {
+			log.Error("clone failed", "err", err)
+			c.setLastOperation(instanceId, model.LAST_OPERATION_FAILED,
+				fmt.Sprintf("failed to clone service instance %s: %s", sourceId, err.Error()), true)
+			return
+		}
+
+		log.Info("clone succeeded")
+		c.setLastOperation(instanceId, model.LAST_OPERATION_SUCCEEDED,
+			fmt.Sprintf("successfully cloned service instance %s", sourceId), true)
+	}()
+}
+
+// Private instance methods
+
+func (c *Controller) setLastOperation(instanceId, state, description string, finished bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	instance, ok := c.instanceMap[instanceId]
+	if !ok {
+		return
+	}
+
+	instance.LastOperation = &model.LastOperation{
+		State:                    state,
+		Description:              description,
+		AsyncPollIntervalSeconds: DEFAULT_POLLING_INTERVAL_SECONDS,
+	}
+	if finished {
+		instance.Operation = ""
+		if err := utils.MarshalAndRecord(c.instanceMap, conf.DataPath, conf.ServiceInstancesFileName); err != nil {
+			logger.Error("recording service instances failed", "err", err)
+		}
+	}
+}
+
+// failInterruptedOperations marks operations that were still running when the
+// broker stopped as failed, since nothing is going to finish them.
+func (c *Controller) failInterruptedOperations() error {
+	interrupted := false
+	for _, instance := range c.instanceMap {
+		if instance.Operation == "" {
+			continue
+		}
+
+		instance.LastOperation = &model.LastOperation{
+			State:       model.LAST_OPERATION_FAILED,
+			Description: fmt.Sprintf("%s interrupted by broker restart", instance.Operation),
+		}
+		instance.Operation = ""
+		interrupted = true
+	}
+
+	if !interrupted {
+		return nil
+	}
+	return utils.MarshalAndRecord(c.instanceMap, conf.DataPath, conf.ServiceInstancesFileName)
+}
+
+func sameNamespace(a, b *model.Context) bool {
+	namespace := func(ctx *model.Context) string {
+		if ctx == nil || ctx.Platform != model.PLATFORM_KUBERNETES {
+			return ""
+		}
+		return ctx.Namespace
+	}
+	return namespace(a) == namespace(b)
+}
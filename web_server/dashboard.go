@@ -0,0 +1,287 @@
+package web_server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/audit"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	DASHBOARD_PATH = "/dashboard/instances/"
+
+	DASHBOARD_SESSION_COOKIE   = "dashboard_session"
+	DASHBOARD_SESSION_LIFETIME = time.Hour
+	// The sign in state is only accepted from the browser that started the
+	// sign in, which holds the nonce it is bound to in this cookie.
+	DASHBOARD_SSO_NONCE_COOKIE = "dashboard_sso_nonce"
+
+	// How many of the latest operations on an instance the dashboard shows.
+	DASHBOARD_OPERATIONS = 20
+
+	// Purposes of signed dashboard values, so that one can not pass for
+	// another.
+	DASHBOARD_TOKEN     = "token"
+	DASHBOARD_SESSION   = "session"
+	DASHBOARD_SSO_STATE = "sso_state"
+)
+
+// Dashboard shows the size, tables, connections, bindings and recent
+// operations of a service instance. The request must carry the token of the
+// instance's dashboard URL or a session from signing in, without either it
+// is sent to sign in if single sign-on is configured.
+func (c *Controller) Dashboard(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("get dashboard")
+
+	if !dashboardEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	instanceId := utils.ExtractVarsFromRequest(r, "service_instance_guid")
+	if !dashboardAuthorized(r, instanceId) {
+		if dashboardSSOEnabled() {
+			c.redirectToSignIn(w, r, instanceId)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden"))
+		return
+	}
+
+	dashboard := c.instanceDashboard(log, instanceId)
+	if dashboard == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	if err := dashboardTemplate.Execute(w, dashboard); err != nil {
+		log.Error("rendering dashboard failed", "instance_id", instanceId, "err", err)
+	}
+}
+
+// Private instance methods
+
+// instanceDashboard gathers what the dashboard of an instance shows, or
+// returns nil if the instance does not exist. What can not be read is left
+// out and noted in the dashboard's errors, the details only go to the log.
+func (c *Controller) instanceDashboard(log *logger.Logger, instanceId string) *model.Dashboard {
+	instance := c.getInstance(instanceId)
+	if instance == nil {
+		return nil
+	}
+
+	dashboard := &model.Dashboard{
+		Instance: instance,
+		Bindings: c.listBindings(instanceId),
+	}
+	sort.Sort(bindingsById(dashboard.Bindings))
+	if instance.Suspended {
+		dashboard.State = INSTANCE_STATE_SUSPENDED
+	} else if instance.LastOperation != nil {
+		dashboard.State = instance.LastOperation.State
+	}
+
+	var err error
+	if dashboard.Tables, err = client.Tables(instance.InternalId); err != nil {
+		log.Warn("reading tables failed", "instance_id", instanceId, "err", err)
+		dashboard.Errors = append(dashboard.Errors, "The tables could not be read.")
+	}
+	for _, table := range dashboard.Tables {
+		dashboard.SizeBytes += table.SizeBytes
+	}
+	if dashboard.Connections, err = client.Connections(instance.InternalId); err != nil {
+		log.Warn("reading connections failed", "instance_id", instanceId, "err", err)
+		dashboard.Errors = append(dashboard.Errors, "The connections could not be read.")
+	}
+	if dashboard.Operations, err = c.audit.Query(audit.Filter{InstanceId: instanceId, Limit: DASHBOARD_OPERATIONS}); err != nil {
+		log.Warn("reading operations failed", "instance_id", instanceId, "err", err)
+		dashboard.Errors = append(dashboard.Errors, "The recent operations could not be read.")
+	}
+
+	return dashboard
+}
+
+// Private methods
+
+func dashboardEnabled() bool {
+	return conf.Dashboard.BaseUrl != ""
+}
+
+func dashboardSSOEnabled() bool {
+	return conf.Dashboard.UaaUrl != "" && conf.Dashboard.CloudControllerUrl != ""
+}
+
+// dashboardUrl returns the URL of the dashboard of an instance, or an empty
+// string if the dashboard is off. With single sign-on users sign in instead
+// of presenting a token. The token does not expire, it is valid for as long
+// as the instance exists and the dashboard secret stays the same, so
+// changing the secret is how to revoke the tokens handed out.
+func dashboardUrl(instanceId string) string {
+	if !dashboardEnabled() {
+		return ""
+	}
+
+	dashboardUrl := strings.TrimRight(conf.Dashboard.BaseUrl, "/") + DASHBOARD_PATH + url.PathEscape(instanceId)
+	if !dashboardSSOEnabled() {
+		dashboardUrl += "?token=" + dashboardSignature(DASHBOARD_TOKEN, instanceId)
+	}
+	return dashboardUrl
+}
+
+// dashboardAuthorized reports whether the request carries a session for the
+// instance or, without single sign-on, its token. With single sign-on tokens
+// are refused, they do not expire and would get around signing in.
+func dashboardAuthorized(r *http.Request, instanceId string) bool {
+	if token := r.URL.Query().Get("token"); token != "" && !dashboardSSOEnabled() {
+		return hmac.Equal([]byte(token), []byte(dashboardSignature(DASHBOARD_TOKEN, instanceId)))
+	}
+
+	cookie, err := r.Cookie(DASHBOARD_SESSION_COOKIE)
+	if err != nil {
+		return false
+	}
+	sessionInstanceId, ok := verifyExpiringDashboardValue(DASHBOARD_SESSION, cookie.Value, time.Now())
+	return ok && sessionInstanceId == instanceId
+}
+
+// dashboardSignature signs the parts of a dashboard value with the dashboard
+// secret.
+func dashboardSignature(purpose string, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(conf.Dashboard.Secret))
+	mac.Write([]byte(purpose))
+	for _, part := range parts {
+		mac.Write([]byte{0})
+		mac.Write([]byte(part))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// expiringDashboardValue returns a signed value naming an instance that is
+// valid until expires, for session cookies and sign in states. The value is
+// bound to the given parts, which it does not carry: verifying it needs the
+// same parts.
+func expiringDashboardValue(purpose, instanceId string, expires time.Time, bound ...string) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return instanceId + "|" + expiry + "|" + dashboardSignature(purpose, append([]string{instanceId, expiry}, bound...)...)
+}
+
+func verifyExpiringDashboardValue(purpose, value string, now time.Time, bound ...string) (string, bool) {
+	parts := strings.Split(value, "|")
+	if len(parts) != 3 {
+		return "", false
+	}
+	instanceId, expiry, signature := parts[0], parts[1], parts[2]
+	if !hmac.Equal([]byte(signature), []byte(dashboardSignature(purpose, append([]string{instanceId, expiry}, bound...)...))) {
+		return "", false
+	}
+
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return "", false
+	}
+	return instanceId, true
+}
+
+func validateDashboard() error {
+	if !dashboardEnabled() {
+		return nil
+	}
+
+	base, err := url.Parse(conf.Dashboard.BaseUrl)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return errors.New(fmt.Sprintf("Invalid dashboard base_url: %s", conf.Dashboard.BaseUrl))
+	}
+	if conf.Dashboard.Secret == "" {
+		return errors.New("Invalid dashboard configuration: secret is empty")
+	}
+	if (conf.Dashboard.UaaUrl == "") != (conf.Dashboard.CloudControllerUrl == "") {
+		return errors.New("Invalid dashboard configuration: single sign-on needs both uaa_url and cloud_controller_url")
+	}
+	return nil
+}
+
+func formatBytes(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value, unit := float64(size), 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>MySQL service instance {{.Instance.Id}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+th { background: #f3f3f3; }
+.error { color: #a00; }
+</style>
+</head>
+<body>
+<h1>MySQL service instance {{.Instance.Id}}</h1>
+{{range .Errors}}<p class="error">{{.}}</p>
+{{end}}
+<table>
+<tr><th>Plan</th><td>{{.Instance.PlanId}}</td></tr>
+<tr><th>State</th><td>{{.State}}</td></tr>
+<tr><th>Database</th><td>{{.Instance.InternalId}}</td></tr>
+<tr><th>Size</th><td>{{bytes .SizeBytes}}</td></tr>
+</table>
+
+<h2>Tables ({{len .Tables}})</h2>
+<table>
+<tr><th>Name</th><th>Engine</th><th>Rows (estimated)</th><th>Size</th></tr>
+{{range .Tables}}<tr><td>{{.Name}}</td><td>{{.Engine}}</td><td>{{.Rows}}</td><td>{{bytes .SizeBytes}}</td></tr>
+{{end}}</table>
+
+<h2>Active connections ({{len .Connections}})</h2>
+<table>
+<tr><th>Id</th><th>User</th><th>Host</th><th>Command</th><th>Time (s)</th><th>State</th></tr>
+{{range .Connections}}<tr><td>{{.Id}}</td><td>{{.User}}</td><td>{{.Host}}</td><td>{{.Command}}</td><td>{{.TimeSeconds}}</td><td>{{.State}}</td></tr>
+{{end}}</table>
+
+<h2>Bindings ({{len .Bindings}})</h2>
+<table>
+<tr><th>Id</th><th>App</th><th>Endpoint</th></tr>
+{{range .Bindings}}<tr><td>{{.Id}}</td><td>{{.AppId}}</td><td>{{.Endpoint}}</td></tr>
+{{end}}</table>
+
+<h2>Recent operations</h2>
+<table>
+<tr><th>Time</th><th>Operation</th><th>Outcome</th><th>Error</th></tr>
+{{range .Operations}}<tr><td>{{.Time.Format "2006-01-02 15:04:05 MST"}}</td><td>{{.Operation}}</td><td>{{.Outcome}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
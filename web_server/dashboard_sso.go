@@ -0,0 +1,249 @@
+package web_server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	DASHBOARD_SSO_CALLBACK_PATH = "/dashboard/sso/callback"
+
+	// How long a user may take to sign in.
+	DASHBOARD_SSO_STATE_LIFETIME = 10 * time.Minute
+	DASHBOARD_SSO_SCOPE          = "openid cloud_controller_service_permissions.read"
+)
+
+var ssoClient = &http.Client{Timeout: 10 * time.Second}
+
+type dashboardClient struct {
+	Id     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// DashboardSignInCallback finishes the sign in started by the dashboard: it
+// exchanges the authorization code for a token, asks the Cloud Controller
+// whether the user may manage the instance and, if so, starts a dashboard
+// session for the instance.
+func (c *Controller) DashboardSignInCallback(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("dashboard sign in callback")
+
+	if !dashboardEnabled() || !dashboardSSOEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// The nonce is good for one sign in only.
+	var nonce string
+	if cookie, err := r.Cookie(DASHBOARD_SSO_NONCE_COOKIE); err == nil {
+		nonce = cookie.Value
+	}
+	setDashboardCookie(w, DASHBOARD_SSO_NONCE_COOKIE, "", DASHBOARD_SSO_CALLBACK_PATH, -1)
+
+	query := r.URL.Query()
+	instanceId, ok := verifyExpiringDashboardValue(DASHBOARD_SSO_STATE, query.Get("state"), time.Now(), nonce)
+	if nonce == "" || !ok {
+		writeBrokerError(w, http.StatusBadRequest, errors.New("Invalid or expired sign in state, open the dashboard again"))
+		return
+	}
+	if query.Get("error") != "" {
+		log.Info("dashboard sign in refused", "instance_id", instanceId, "error", query.Get("error"))
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden"))
+		return
+	}
+
+	instance := c.getInstance(instanceId)
+	if instance == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	client, err := c.dashboardClient(instance.ServiceId)
+	if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	accessToken, err := exchangeAuthorizationCode(client, query.Get("code"))
+	if err != nil {
+		log.Warn("dashboard sign in failed", "instance_id", instanceId, "err", err)
+		writeBrokerError(w, http.StatusBadGateway, errors.New("Sign in failed"))
+		return
+	}
+	manage, err := canManageInstance(accessToken, instanceId)
+	if err != nil {
+		log.Warn("reading service instance permissions failed", "instance_id", instanceId, "err", err)
+		writeBrokerError(w, http.StatusBadGateway, errors.New("Could not check the permissions on the service instance"))
+		return
+	}
+	if !manage {
+		log.Info("dashboard access denied", "instance_id", instanceId)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden"))
+		return
+	}
+
+	setDashboardCookie(w, DASHBOARD_SESSION_COOKIE,
+		expiringDashboardValue(DASHBOARD_SESSION, instanceId, time.Now().Add(DASHBOARD_SESSION_LIFETIME)),
+		DASHBOARD_PATH+url.PathEscape(instanceId), DASHBOARD_SESSION_LIFETIME)
+	log.Info("dashboard session started", "instance_id", instanceId)
+
+	http.Redirect(w, r, dashboardUrl(instanceId), http.StatusFound)
+}
+
+// Private instance methods
+
+// redirectToSignIn sends the user to the UAA to sign in with the dashboard
+// client of the instance's service. The state passed along is bound to a
+// nonce kept in a cookie, so that a sign in started by someone else can not
+// be finished in the user's browser.
+func (c *Controller) redirectToSignIn(w http.ResponseWriter, r *http.Request, instanceId string) {
+	instance := c.getInstance(instanceId)
+	if instance == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	client, err := c.dashboardClient(instance.ServiceId)
+	if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	nonce := utils.GetGuid()
+	if nonce == "" {
+		writeBrokerError(w, http.StatusInternalServerError, errors.New("Could not generate a sign in nonce"))
+		return
+	}
+	setDashboardCookie(w, DASHBOARD_SSO_NONCE_COOKIE, nonce, DASHBOARD_SSO_CALLBACK_PATH, DASHBOARD_SSO_STATE_LIFETIME)
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", client.Id)
+	query.Set("redirect_uri", dashboardCallbackUrl())
+	query.Set("scope", DASHBOARD_SSO_SCOPE)
+	query.Set("state", expiringDashboardValue(DASHBOARD_SSO_STATE, instanceId, time.Now().Add(DASHBOARD_SSO_STATE_LIFETIME), nonce))
+
+	http.Redirect(w, r, strings.TrimRight(conf.Dashboard.UaaUrl, "/")+"/oauth/authorize?"+query.Encode(), http.StatusFound)
+}
+
+// dashboardClient returns the dashboard_client of a service in the catalog.
+func (c *Controller) dashboardClient(serviceId string) (*dashboardClient, error) {
+	catalog, err := c.loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, service := range catalog.Services {
+		if service.Id == serviceId {
+			return parseDashboardClient(service)
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Service %s is not in the catalog", serviceId))
+}
+
+// Private methods
+
+func parseDashboardClient(service model.Service) (*dashboardClient, error) {
+	var client dashboardClient
+	if encoded, err := json.Marshal(service.DashboardClient); err == nil {
+		json.Unmarshal(encoded, &client)
+	}
+	if client.Id == "" || client.Secret == "" {
+		return nil, errors.New(fmt.Sprintf("Service %s has no dashboard_client with an id and a secret", service.Name))
+	}
+	return &client, nil
+}
+
+// setDashboardCookie sets a cookie for path below the dashboard base URL
+// that lasts lifetime, or removes it if lifetime is negative.
+func setDashboardCookie(w http.ResponseWriter, name, value, path string, lifetime time.Duration) {
+	base, _ := url.Parse(conf.Dashboard.BaseUrl)
+	maxAge := -1
+	if lifetime >= 0 {
+		maxAge = int(lifetime / time.Second)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     strings.TrimRight(base.Path, "/") + path,
+		MaxAge:   maxAge,
+		Secure:   base.Scheme == "https",
+		HttpOnly: true,
+	})
+}
+
+func dashboardCallbackUrl() string {
+	return strings.TrimRight(conf.Dashboard.BaseUrl, "/") + DASHBOARD_SSO_CALLBACK_PATH
+}
+
+// exchangeAuthorizationCode returns the access token the UAA issues for an
+// authorization code.
+func exchangeAuthorizationCode(client *dashboardClient, code string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", dashboardCallbackUrl())
+
+	request, err := http.NewRequest("POST", strings.TrimRight(conf.Dashboard.UaaUrl, "/")+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(client.Id, client.Secret)
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doSSORequest(request, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("the UAA returned no access token")
+	}
+	return token.AccessToken, nil
+}
+
+// canManageInstance asks the Cloud Controller whether the user of an access
+// token may manage a service instance.
+func canManageInstance(accessToken, instanceId string) (bool, error) {
+	request, err := http.NewRequest("GET", strings.TrimRight(conf.Dashboard.CloudControllerUrl, "/")+
+		"/v2/service_instances/"+url.PathEscape(instanceId)+"/permissions", nil)
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", "bearer "+accessToken)
+
+	var permissions struct {
+		Manage bool `json:"manage"`
+	}
+	if err := doSSORequest(request, &permissions); err != nil {
+		return false, err
+	}
+	return permissions.Manage, nil
+}
+
+func doSSORequest(request *http.Request, result interface{}) error {
+	response, err := ssoClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+		return errors.New(fmt.Sprintf("%s %s answered %s", request.Method, request.URL.Path, response.Status))
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1024*1024)).Decode(result)
+}
@@ -0,0 +1,61 @@
+package web_server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+)
+
+func TestDashboardSignInCallbackNonce(t *testing.T) {
+	saved := conf.Dashboard
+	defer func() { conf.Dashboard = saved }()
+	conf.Dashboard = config.DashboardConfig{
+		BaseUrl:            "https://broker.example.com",
+		Secret:             "secret",
+		UaaUrl:             "https://uaa.example.com",
+		CloudControllerUrl: "https://api.example.com",
+	}
+
+	expires := time.Now().Add(DASHBOARD_SSO_STATE_LIFETIME)
+	tests := []struct {
+		name   string
+		state  string
+		nonce  string
+		status int
+	}{
+		{"state bound to the nonce", expiringDashboardValue(DASHBOARD_SSO_STATE, "instance", expires, "nonce"), "nonce", http.StatusNotFound},
+		{"no nonce cookie", expiringDashboardValue(DASHBOARD_SSO_STATE, "instance", expires, "nonce"), "", http.StatusBadRequest},
+		{"nonce of another sign in", expiringDashboardValue(DASHBOARD_SSO_STATE, "instance", expires, "nonce"), "other", http.StatusBadRequest},
+		{"state without a nonce", expiringDashboardValue(DASHBOARD_SSO_STATE, "instance", expires), "nonce", http.StatusBadRequest},
+		{"expired state", expiringDashboardValue(DASHBOARD_SSO_STATE, "instance", time.Now().Add(-time.Second), "nonce"), "nonce", http.StatusBadRequest},
+		{"session value as state", expiringDashboardValue(DASHBOARD_SESSION, "instance", expires, "nonce"), "nonce", http.StatusBadRequest},
+	}
+
+	controller := &Controller{}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", DASHBOARD_SSO_CALLBACK_PATH+"?code=code&state="+url.QueryEscape(test.state), nil)
+		if test.nonce != "" {
+			request.AddCookie(&http.Cookie{Name: DASHBOARD_SSO_NONCE_COOKIE, Value: test.nonce})
+		}
+		recorder := httptest.NewRecorder()
+		controller.DashboardSignInCallback(recorder, request)
+
+		// A valid state gets as far as looking up the instance, which does
+		// not exist here.
+		if recorder.Code != test.status {
+			t.Errorf("%s: status is %d, want %d", test.name, recorder.Code, test.status)
+		}
+
+		cleared := false
+		for _, cookie := range recorder.Result().Cookies() {
+			cleared = cleared || (cookie.Name == DASHBOARD_SSO_NONCE_COOKIE && cookie.MaxAge < 0)
+		}
+		if !cleared {
+			t.Errorf("%s: the nonce cookie is not cleared", test.name)
+		}
+	}
+}
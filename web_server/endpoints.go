@@ -0,0 +1,82 @@
+package web_server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+const (
+	ENDPOINT_PARAMETER = "endpoint"
+
+	ENDPOINT_INTERNAL = "internal"
+	ENDPOINT_EXTERNAL = "external"
+)
+
+// advertisedEndpoint returns the endpoint of the backend server holding
+// instance that apps should connect to, internal or external. Without a
+// configured internal endpoint, the address the broker itself uses for that
+// server is advertised.
+func advertisedEndpoint(instance *model.ServiceInstance, kind string) (config.Endpoint, error) {
+	server := instanceServer(instance)
+	endpoints := conf.AdvertisedEndpoints[server]
+
+	switch kind {
+	case ENDPOINT_INTERNAL, "":
+		if endpoints.Internal.Host != "" {
+			return withDefaultPort(endpoints.Internal), nil
+		}
+		host, portText, err := net.SplitHostPort(server)
+		if err != nil {
+			host = server
+		}
+		port, _ := strconv.Atoi(portText)
+		return withDefaultPort(config.Endpoint{Host: host, Port: port}), nil
+
+	case ENDPOINT_EXTERNAL:
+		if endpoints.External.Host == "" {
+			return config.Endpoint{}, errors.New(fmt.Sprintf("Invalid %s: no external endpoint is configured for this service", ENDPOINT_PARAMETER))
+		}
+		return withDefaultPort(endpoints.External), nil
+	}
+
+	return config.Endpoint{}, errors.New(fmt.Sprintf("Invalid %s: %s, expected %s or %s", ENDPOINT_PARAMETER, kind, ENDPOINT_INTERNAL, ENDPOINT_EXTERNAL))
+}
+
+// bindingCredential returns the credential of an instance as handed out to
+// one of its bindings, for the endpoint and in the formats it asked for.
+func bindingCredential(instance *model.ServiceInstance, credential *model.Credential, binding *model.ServiceBinding) *model.Credential {
+	endpoint, err := advertisedEndpoint(instance, binding.Endpoint)
+	if err != nil {
+		// The endpoint was valid when the binding was created, keep the
+		// address recorded with the credential.
+		logger.Warn("advertised endpoint is gone", "binding_id", binding.Id, "endpoint", binding.Endpoint, "err", err)
+		return credential.WithFormats(binding.CredentialFormats)
+	}
+
+	return credential.WithEndpoint(endpoint.Host, endpoint.Port).WithFormats(binding.CredentialFormats)
+}
+
+// Private methods
+
+// instanceServer returns the address of the backend server holding instance.
+// Instances recorded without one are on the server the broker uses.
+func instanceServer(instance *model.ServiceInstance) string {
+	if instance == nil || instance.Server == "" {
+		return client.Address()
+	}
+	return instance.Server
+}
+
+func withDefaultPort(endpoint config.Endpoint) config.Endpoint {
+	if endpoint.Port == 0 {
+		endpoint.Port = 3306
+	}
+	return endpoint
+}
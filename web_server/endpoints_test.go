@@ -0,0 +1,51 @@
+package web_server
+
+import (
+	"testing"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+func TestAdvertisedEndpoint(t *testing.T) {
+	savedEndpoints, savedAddr, savedPort := conf.AdvertisedEndpoints, client.DB_ADDR, client.DB_PORT
+	defer func() {
+		conf.AdvertisedEndpoints, client.DB_ADDR, client.DB_PORT = savedEndpoints, savedAddr, savedPort
+	}()
+
+	client.DB_ADDR, client.DB_PORT = "mysql-a", "3306"
+	conf.AdvertisedEndpoints = map[string]config.ServerEndpoints{
+		"mysql-a:3306": {Internal: config.Endpoint{Host: "a.internal"}, External: config.Endpoint{Host: "a.example.com", Port: 30306}},
+		"mysql-b:3307": {External: config.Endpoint{Host: "b.example.com", Port: 30307}},
+	}
+
+	tests := []struct {
+		server, kind string
+		endpoint     config.Endpoint
+	}{
+		// Instances recorded without a server are on the one the broker uses.
+		{"", ENDPOINT_INTERNAL, config.Endpoint{Host: "a.internal", Port: 3306}},
+		{"", ENDPOINT_EXTERNAL, config.Endpoint{Host: "a.example.com", Port: 30306}},
+		{"mysql-a:3306", "", config.Endpoint{Host: "a.internal", Port: 3306}},
+		{"mysql-b:3307", ENDPOINT_EXTERNAL, config.Endpoint{Host: "b.example.com", Port: 30307}},
+		// Without an internal endpoint, the address of the server itself.
+		{"mysql-b:3307", ENDPOINT_INTERNAL, config.Endpoint{Host: "mysql-b", Port: 3307}},
+		{"mysql-c:3308", ENDPOINT_INTERNAL, config.Endpoint{Host: "mysql-c", Port: 3308}},
+	}
+
+	for _, test := range tests {
+		endpoint, err := advertisedEndpoint(&model.ServiceInstance{Server: test.server}, test.kind)
+		if err != nil {
+			t.Errorf("%s %s: %s", test.server, test.kind, err)
+			continue
+		}
+		if endpoint != test.endpoint {
+			t.Errorf("%s %s: endpoint is %+v, want %+v", test.server, test.kind, endpoint, test.endpoint)
+		}
+	}
+
+	if _, err := advertisedEndpoint(&model.ServiceInstance{Server: "mysql-c:3308"}, ENDPOINT_EXTERNAL); err == nil {
+		t.Errorf("mysql-c:3308 has an external endpoint")
+	}
+}
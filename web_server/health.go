@@ -0,0 +1,110 @@
+package web_server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const READINESS_PING_TIMEOUT = 2 * time.Second
+
+// Healthz reports that the process is up and serving requests.
+func (c *Controller) Healthz(w http.ResponseWriter, r *http.Request) {
+	utils.WriteResponse(w, http.StatusOK, model.HealthResponse{Status: model.HEALTH_STATUS_OK})
+}
+
+// Readyz reports whether the broker can serve the service broker API: the
+// store is loaded, the catalog is valid and the backend MySQL server is
+// reachable. It responds with 503 if any of them is not.
+func (c *Controller) Readyz(w http.ResponseWriter, r *http.Request) {
+	response := model.HealthResponse{
+		Status: model.HEALTH_STATUS_OK,
+		Checks: map[string]*model.HealthCheck{
+			"store":                     c.checkStore(),
+			"catalog":                   c.checkCatalog(),
+			"mysql:" + client.Address(): checkMysql(),
+		},
+	}
+
+	code := http.StatusOK
+	for _, check := range response.Checks {
+		if check.Status != model.HEALTH_STATUS_OK {
+			response.Status = model.HEALTH_STATUS_UNAVAILABLE
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	utils.WriteResponse(w, code, response)
+}
+
+// Private instance methods
+
+func (c *Controller) checkStore() *model.HealthCheck {
+	start := time.Now()
+
+	c.lock.RLock()
+	detail := map[string]int{
+		"instances":         len(c.instanceMap),
+		"bindings":          len(c.bindingMap),
+		"credentials":       len(c.credentialMap),
+		"deleted_instances": len(c.deletedMap),
+	}
+	loaded := c.instanceMap != nil && c.bindingMap != nil && c.credentialMap != nil
+	c.lock.RUnlock()
+
+	var err error
+	if !loaded {
+		err = errors.New("store is not loaded")
+	} else if info, statErr := os.Stat(conf.DataPath); statErr != nil {
+		err = statErr
+	} else if !info.IsDir() {
+		err = errors.New(fmt.Sprintf("data path %s is not a directory", conf.DataPath))
+	}
+
+	return newHealthCheck(start, err, detail)
+}
+
+func (c *Controller) checkCatalog() *model.HealthCheck {
+	start := time.Now()
+
+	catalog, err := c.loadCatalog()
+	if err == nil {
+		err = catalog.Validate()
+	}
+
+	var detail interface{}
+	if err == nil {
+		plans := 0
+		for _, service := range catalog.Services {
+			plans += len(service.Plans)
+		}
+		detail = map[string]int{"services": len(catalog.Services), "plans": plans}
+	}
+
+	return newHealthCheck(start, err, detail)
+}
+
+func checkMysql() *model.HealthCheck {
+	start := time.Now()
+	_, err := client.Ping(READINESS_PING_TIMEOUT)
+	return newHealthCheck(start, err, nil)
+}
+
+func newHealthCheck(start time.Time, err error, detail interface{}) *model.HealthCheck {
+	check := &model.HealthCheck{
+		Status:     model.HEALTH_STATUS_OK,
+		DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+		Detail:     detail,
+	}
+	if err != nil {
+		check.Status = model.HEALTH_STATUS_UNAVAILABLE
+		check.Error = err.Error()
+	}
+	return check
+}
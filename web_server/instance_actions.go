@@ -0,0 +1,265 @@
+package web_server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+// AdminRotateCredentials gives the database user of an instance a new
+// password. Bindings return the new password from then on, applications have
+// to fetch their binding again to reconnect.
+func (c *Controller) AdminRotateCredentials(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin rotate credentials")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	instanceId := utils.ExtractVarsFromRequest(r, "service_instance_guid")
+	if _, ok := c.instanceMap[instanceId]; !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	credential, ok := c.credentialMap[instanceId]
+	if !ok {
+		writeBrokerError(w, http.StatusConflict, errors.New("the service instance has no credential, resync it first"))
+		return
+	}
+
+	rotated := *credential
+	rotated.Password = utils.GetGuid()
+	rotated.Uri = rotated.BuildUri()
+	if err := client.ResetCredential(log, rotated); err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.credentialMap[instanceId] = &rotated
+	if err := utils.MarshalAndRecord(c.credentialMap, conf.DataPath, conf.ServicdCredentialsFileName); err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Info("credentials rotated", "instance_id", instanceId, "user", rotated.Username)
+
+	utils.WriteResponse(w, http.StatusOK, "{}")
+}
+
+// AdminResyncInstance makes the backend server match what the broker has
+// stored for an instance, see resyncInstance.
+func (c *Controller) AdminResyncInstance(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin resync instance")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	instanceId := utils.ExtractVarsFromRequest(r, "service_instance_guid")
+	instance, ok := c.instanceMap[instanceId]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	report, err := c.resyncInstance(log, instance, true)
+	if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := utils.MarshalAndRecord(c.instanceMap, conf.DataPath, conf.ServiceInstancesFileName); err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusOK, report)
+}
+
+// Reconcile compares every service instance with the backend server and
+// lists the broker databases no instance refers to. With repair set the
+// instances are resynced, orphan databases are never dropped.
+func (c *Controller) Reconcile(log *logger.Logger, repair bool) (*model.ReconcileReport, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	report := &model.ReconcileReport{
+		Instances:       make([]*model.ResyncReport, 0, len(c.instanceMap)),
+		OrphanDatabases: make([]string, 0),
+	}
+
+	known := make(map[string]bool)
+	for _, instance := range c.instanceMap {
+		known[instance.InternalId] = true
+
+		resync, err := c.resyncInstance(log, instance, repair)
+		if err != nil {
+			return nil, err
+		}
+		report.Instances = append(report.Instances, resync)
+	}
+	sort.Sort(resyncReportsById(report.Instances))
+
+	if repair {
+		if err := utils.MarshalAndRecord(c.instanceMap, conf.DataPath, conf.ServiceInstancesFileName); err != nil {
+			return nil, err
+		}
+	}
+
+	databases, err := client.BrokerDatabases()
+	if err != nil {
+		return nil, err
+	}
+	for _, database := range databases {
+		if !known[database] {
+			report.OrphanDatabases = append(report.OrphanDatabases, database)
+		}
+	}
+	sort.Strings(report.OrphanDatabases)
+
+	return report, nil
+}
+
+// AdminForceDeleteInstance drops the database and user of an instance and
+// forgets the instance and its bindings, skipping soft deletion and final
+// snapshots, even if an operation is in progress. A database or user that no
+// longer exists is not an error. It requires "confirm": true in the request
+// body.
+func (c *Controller) AdminForceDeleteInstance(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin force delete instance")
+
+	var request model.ForceDeleteRequest
+	if err := utils.ProvisionDataFromRequest(r, &request); err != nil {
+		writeBrokerError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !request.Confirm {
+		writeBrokerError(w, http.StatusUnprocessableEntity, errors.New("force delete drops the data of the instance right away, set \"confirm\": true to proceed"))
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	instanceId := utils.ExtractVarsFromRequest(r, "service_instance_guid")
+	instance, ok := c.instanceMap[instanceId]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	exists, err := client.DatabaseExists(instance.InternalId)
+	if err == nil && exists {
+		err = client.DropDatabase(log, instance.InternalId)
+	}
+	if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := c.deleteCredentials(log, instanceId); err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := c.forgetSuspension(instanceId); err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+	delete(c.instanceMap, instanceId)
+	if err := utils.MarshalAndRecord(c.instanceMap, conf.DataPath, conf.ServiceInstancesFileName); err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := c.deleteAssociatedBindings(instanceId); err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Info("service instance force deleted", "instance_id", instanceId, "database", instance.InternalId)
+	c.recordUsage(log, model.USAGE_STATE_DELETED, instance)
+
+	utils.WriteResponse(w, http.StatusOK, "{}")
+}
+
+// Private instance methods
+
+// resyncInstance checks that the database and user of an instance exist on
+// the backend server. With repair set, the user is created again if it is
+// missing, and its password, SSL requirement and privileges are reapplied,
+// unless the instance is suspended. A missing database is only reported, its
+// data has to come from a backup.
+// Must be called with c.lock held, the caller records the instances.
+func (c *Controller) resyncInstance(log *logger.Logger, instance *model.ServiceInstance, repair bool) (*model.ResyncReport, error) {
+	report := &model.ResyncReport{
+		InstanceId: instance.Id,
+		Database:   instance.InternalId,
+		Repaired:   repair,
+		Actions:    make([]string, 0),
+	}
+
+	var err error
+	report.DatabaseExists, err = client.DatabaseExists(instance.InternalId)
+	if err != nil {
+		return nil, err
+	}
+	if !report.DatabaseExists {
+		report.Actions = append(report.Actions, "database is missing, restore it from a backup")
+	}
+
+	credential, ok := c.credentialMap[instance.Id]
+	if !ok {
+		report.Actions = append(report.Actions, "service instance has no credential")
+	} else if instance.Suspended {
+		// Reapplying the privileges would lift the suspension.
+		report.Username = credential.Username
+		report.UserExists, err = client.UserExists(credential.Username)
+		if err != nil {
+			return nil, err
+		}
+		report.Actions = append(report.Actions, "service instance is suspended, user left as it is")
+	} else {
+		report.Username = credential.Username
+		report.UserExists, err = client.UserExists(credential.Username)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !report.UserExists && !repair:
+			report.Actions = append(report.Actions, "user is missing")
+		case !report.UserExists:
+			if err := client.SetCredential(log, *credential); err != nil {
+				return nil, err
+			}
+			report.Actions = append(report.Actions, "created user")
+		case repair:
+			if err := client.ResetCredential(log, *credential); err != nil {
+				return nil, err
+			}
+			if err := client.GrantPrivileges(log, credential.Database, credential.Username); err != nil {
+				return nil, err
+			}
+			report.Actions = append(report.Actions, "reset password and privileges of user")
+		}
+	}
+
+	if instance.Server == "" && repair {
+		instance.Server = client.Address()
+		report.Actions = append(report.Actions, "recorded server of service instance")
+	}
+
+	if repair {
+		log.Info("service instance resynced", "instance_id", instance.Id, "actions", report.Actions)
+	}
+	return report, nil
+}
+
+type resyncReportsById []*model.ResyncReport
+
+func (a resyncReportsById) Len() int           { return len(a) }
+func (a resyncReportsById) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a resyncReportsById) Less(i, j int) bool { return a[i].InstanceId < a[j].InstanceId }
@@ -0,0 +1,177 @@
+package web_server
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+var ErrInstanceNotFound = errors.New("service instance not found")
+
+// ListInstances returns the service instances matching filter, sorted by id,
+// with the size of their databases and their number of open connections.
+func (c *Controller) ListInstances(log *logger.Logger, filter model.InstanceFilter) []*model.InstanceSummary {
+	instances := make([]*model.InstanceSummary, 0)
+	for _, summary := range c.instanceSummaries(log) {
+		if filter.Matches(summary) {
+			instances = append(instances, summary)
+		}
+	}
+	sort.Sort(summariesById(instances))
+
+	return instances
+}
+
+// InstanceDetail returns a service instance along with its bindings, or nil
+// if it does not exist.
+func (c *Controller) InstanceDetail(log *logger.Logger, instanceId string) *model.InstanceDetail {
+	var summary *model.InstanceSummary
+	for _, s := range c.instanceSummaries(log) {
+		if s.Id == instanceId {
+			summary = s
+		}
+	}
+	if summary == nil {
+		return nil
+	}
+
+	detail := &model.InstanceDetail{InstanceSummary: *summary, BindingList: c.listBindings(instanceId)}
+	sort.Sort(bindingsById(detail.BindingList))
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if credential, ok := c.credentialMap[instanceId]; ok {
+		detail.Username = credential.Username
+		detail.RequireSSL = credential.RequireSSL
+	}
+	if suspension, ok := c.suspensionMap[instanceId]; ok {
+		// Older servers print password hashes with the grants.
+		copied := *suspension
+		copied.Grants = nil
+		detail.Suspension = &copied
+	}
+	return detail
+}
+
+// ListBindings returns the service bindings of an instance, or of all
+// instances if instanceId is empty, whose instance matches the organization,
+// space and plan of filter. They are sorted by id.
+func (c *Controller) ListBindings(instanceId string, filter model.InstanceFilter) []*model.ServiceBinding {
+	instances := make(map[string]*model.ServiceInstance)
+	for _, instance := range c.listInstances() {
+		instances[instance.Id] = instance
+	}
+
+	bindings := make([]*model.ServiceBinding, 0)
+	for _, binding := range c.listBindings(instanceId) {
+		instance, ok := instances[binding.ServiceInstanceId]
+		if !ok || !filter.MatchesInstance(instance) {
+			continue
+		}
+		bindings = append(bindings, binding)
+	}
+	sort.Sort(bindingsById(bindings))
+
+	return bindings
+}
+
+// ListBackups returns the backups of an instance, or of all instances if
+// instanceId is empty, newest first.
+func (c *Controller) ListBackups(instanceId string) []*model.Backup {
+	return c.backups.List(instanceId)
+}
+
+// CreateBackup takes a manual backup of an instance.
+func (c *Controller) CreateBackup(instanceId string) (*model.Backup, error) {
+	instance := c.getInstance(instanceId)
+	if instance == nil {
+		return nil, ErrInstanceNotFound
+	}
+
+	return c.backups.Create(instance.Id, instance.InternalId, model.BACKUP_KIND_MANUAL)
+}
+
+// RestoreBackup replaces the data of an instance with a backup.
+func (c *Controller) RestoreBackup(backupId, instanceId string) error {
+	instance := c.getInstance(instanceId)
+	if instance == nil {
+		return ErrInstanceNotFound
+	}
+
+	return c.backups.Restore(backupId, instance.InternalId)
+}
+
+// Private instance methods
+
+// instanceSummaries returns all service instances along with their usage of
+// the backend server. An unreachable server leaves the usage at zero.
+func (c *Controller) instanceSummaries(log *logger.Logger) []*model.InstanceSummary {
+	sizes, err := client.DatabaseSizes()
+	if err != nil {
+		log.Warn("reading database sizes failed", "err", err)
+	}
+	connections, err := client.DatabaseConnections()
+	if err != nil {
+		log.Warn("reading database connections failed", "err", err)
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	bindings := make(map[string]int)
+	for _, binding := range c.bindingMap {
+		bindings[binding.ServiceInstanceId]++
+	}
+
+	summaries := make([]*model.InstanceSummary, 0, len(c.instanceMap))
+	for _, instance := range c.instanceMap {
+		copied := *instance
+		copied.Server = instanceServer(instance)
+
+		summary := &model.InstanceSummary{
+			ServiceInstance: &copied,
+			SizeBytes:       sizes[instance.InternalId],
+			Connections:     connections[instance.InternalId],
+			Bindings:        bindings[instance.Id],
+		}
+		if instance.Suspended {
+			summary.State = INSTANCE_STATE_SUSPENDED
+		} else if instance.LastOperation != nil {
+			summary.State = instance.LastOperation.State
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// listBindings returns copies of the service bindings of an instance, or of
+// all instances if instanceId is empty.
+func (c *Controller) listBindings(instanceId string) []*model.ServiceBinding {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	bindings := make([]*model.ServiceBinding, 0)
+	for _, binding := range c.bindingMap {
+		if instanceId == "" || binding.ServiceInstanceId == instanceId {
+			copied := *binding
+			bindings = append(bindings, &copied)
+		}
+	}
+	return bindings
+}
+
+type summariesById []*model.InstanceSummary
+
+func (a summariesById) Len() int           { return len(a) }
+func (a summariesById) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a summariesById) Less(i, j int) bool { return a[i].Id < a[j].Id }
+
+type bindingsById []*model.ServiceBinding
+
+func (a bindingsById) Len() int           { return len(a) }
+func (a bindingsById) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a bindingsById) Less(i, j int) bool { return a[i].Id < a[j].Id }
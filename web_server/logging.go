@@ -0,0 +1,58 @@
+package web_server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/context"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// loggingHandler tags every request with an id, taken from the X-Request-Id
+// header when the platform sends one, returns it in the response and logs
+// the request once next has handled it. Handlers get a logger carrying the
+// id from requestLogger.
+func loggingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(REQUEST_ID_HEADER)
+		if requestId == "" {
+			requestId = utils.GetGuid()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, requestId)
+
+		// The router clears the request context once it is done, so keep our
+		// own reference for the access log.
+		log := logger.New("request_id", requestId)
+		context.Set(r, requestLoggerKey, log)
+		context.Set(r, requestIdKey, requestId)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		log.Info("request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", time.Since(start).Nanoseconds()/int64(time.Millisecond))
+	})
+}
+
+func requestIdFromRequest(r *http.Request) string {
+	requestId, _ := context.Get(r, requestIdKey).(string)
+	return requestId
+}
+
+func requestLogger(r *http.Request) *logger.Logger {
+	if log, ok := context.Get(r, requestLoggerKey).(*logger.Logger); ok {
+		return log
+	}
+	return logger.New()
+}
@@ -0,0 +1,237 @@
+package web_server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	MANIFEST_KIND_LIST     = "list"
+	MANIFEST_KIND_TEMPLATE = "template"
+
+	MANIFEST_FORMAT_YAML = "yaml"
+	MANIFEST_FORMAT_JSON = "json"
+
+	// The template parameter that names the Secret and the ConfigMap.
+	TEMPLATE_NAME_PARAMETER = "NAME"
+)
+
+// Credential environment variables that are not secret and go into the
+// ConfigMap, all others go into the Secret.
+var configMapKeys = map[string]bool{
+	"MYSQL_HOST":     true,
+	"MYSQL_PORT":     true,
+	"MYSQL_DATABASE": true,
+	"MYSQL_SSL_MODE": true,
+	"MYSQL_SSL_CA":   true,
+}
+
+// AdminGetBindingManifest renders the credentials of a binding as a Secret
+// and a ConfigMap, keyed by environment variable names so that workloads can
+// load them with envFrom. The kind query parameter selects a Kubernetes List
+// or an OpenShift Template, format selects yaml or json, and name and
+// namespace override the defaults taken from the binding.
+func (c *Controller) AdminGetBindingManifest(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin get binding manifest")
+
+	c.lock.RLock()
+	bindingId := utils.ExtractVarsFromRequest(r, "service_binding_guid")
+	binding := c.bindingMap[bindingId]
+	var credential *model.Credential
+	if binding != nil {
+		credential = c.credentialMap[binding.ServiceInstanceId]
+	}
+	if binding == nil || credential == nil {
+		c.lock.RUnlock()
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	env := bindingCredential(c.instanceMap[binding.ServiceInstanceId], credential, binding).WithFormats([]string{model.CREDENTIAL_FORMAT_ENV}).Env
+	c.lock.RUnlock()
+
+	query := r.URL.Query()
+	name := query.Get("name")
+	if name == "" {
+		name = "mysql-" + bindingId
+	}
+	namespace := query.Get("namespace")
+	if namespace == "" && binding.Context != nil && binding.Context.Platform == model.PLATFORM_KUBERNETES {
+		namespace = binding.Context.Namespace
+	}
+
+	var manifest interface{}
+	switch kind := query.Get("kind"); kind {
+	case MANIFEST_KIND_LIST, "":
+		secret, configMap := bindingObjects(binding, env, name, namespace)
+		manifest = model.List{ApiVersion: "v1", Kind: "List", Items: []interface{}{secret, configMap}}
+	case MANIFEST_KIND_TEMPLATE:
+		// The namespace is chosen when the template is processed.
+		secret, configMap := bindingObjects(binding, env, "${"+TEMPLATE_NAME_PARAMETER+"}", "")
+		manifest = model.Template{
+			ApiVersion: "template.openshift.io/v1",
+			Kind:       "Template",
+			Metadata:   model.ObjectMeta{Name: name, Namespace: namespace},
+			Objects:    []interface{}{secret, configMap},
+			Parameters: []model.TemplateParameter{{
+				Name:        TEMPLATE_NAME_PARAMETER,
+				Description: "Name of the Secret and the ConfigMap holding the MySQL credentials",
+				Value:       name,
+				Required:    true,
+			}},
+		}
+	default:
+		writeBrokerError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid kind: %s, expected %s or %s", kind, MANIFEST_KIND_LIST, MANIFEST_KIND_TEMPLATE)))
+		return
+	}
+
+	switch format := query.Get("format"); format {
+	case MANIFEST_FORMAT_YAML, "":
+		body, err := toYaml(manifest)
+		if err != nil {
+			writeBrokerError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	case MANIFEST_FORMAT_JSON:
+		utils.WriteResponse(w, http.StatusOK, manifest)
+	default:
+		writeBrokerError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid format: %s, expected %s or %s", format, MANIFEST_FORMAT_YAML, MANIFEST_FORMAT_JSON)))
+	}
+}
+
+// Private methods
+
+func bindingObjects(binding *model.ServiceBinding, env map[string]string, name, namespace string) (*model.Secret, *model.ConfigMap) {
+	metadata := model.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels: map[string]string{
+			"app.kubernetes.io/managed-by": "mysql-service-broker",
+			"service-instance-id":          binding.ServiceInstanceId,
+			"service-binding-id":           binding.Id,
+		},
+	}
+
+	secret := &model.Secret{ApiVersion: "v1", Kind: "Secret", Metadata: metadata, Type: "Opaque", Data: map[string]string{}}
+	configMap := &model.ConfigMap{ApiVersion: "v1", Kind: "ConfigMap", Metadata: metadata, Data: map[string]string{}}
+	for key, value := range env {
+		if configMapKeys[key] {
+			configMap.Data[key] = value
+		} else {
+			secret.Data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+
+	return secret, configMap
+}
+
+// toYaml renders object as YAML through its JSON encoding. Strings are
+// written as double quoted JSON strings, which YAML reads as is.
+func toYaml(object interface{}) ([]byte, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	writeYaml(&buffer, decoded, 0)
+	return buffer.Bytes(), nil
+}
+
+func writeYaml(buffer *bytes.Buffer, value interface{}, indent int) {
+	prefix := strings.Repeat("  ", indent)
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			buffer.WriteString(prefix + yamlKey(key) + ":")
+			writeYamlValue(buffer, v[key], indent)
+		}
+	case []interface{}:
+		for _, item := range v {
+			buffer.WriteString(prefix + "-")
+			writeYamlValue(buffer, item, indent)
+		}
+	}
+}
+
+// writeYamlValue writes a mapping value or a sequence item, nested
+// collections go on the following lines.
+func writeYamlValue(buffer *bytes.Buffer, value interface{}, indent int) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			buffer.WriteString(" {}\n")
+			return
+		}
+		buffer.WriteString("\n")
+		writeYaml(buffer, v, indent+1)
+	case []interface{}:
+		if len(v) == 0 {
+			buffer.WriteString(" []\n")
+			return
+		}
+		buffer.WriteString("\n")
+		writeYaml(buffer, v, indent+1)
+	default:
+		buffer.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+// Keys that YAML could read as something other than a string are quoted.
+var plainYamlKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./-]*$`)
+
+func yamlKey(key string) string {
+	switch strings.ToLower(key) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null":
+		return yamlScalar(key)
+	}
+	if plainYamlKey.MatchString(key) {
+		return key
+	}
+	return yamlScalar(key)
+}
+
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case json.Number:
+		return v.String()
+	case string:
+		quoted, _ := json.Marshal(v)
+		return string(quoted)
+	}
+	return fmt.Sprint(value)
+}
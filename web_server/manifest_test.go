@@ -0,0 +1,70 @@
+package web_server
+
+import (
+	"testing"
+)
+
+func TestToYaml(t *testing.T) {
+	tests := []struct {
+		name   string
+		object interface{}
+		yaml   string
+	}{
+		{
+			name: "sorted keys and scalars",
+			object: map[string]interface{}{
+				"kind":    "Secret",
+				"count":   3,
+				"ratio":   1.5,
+				"enabled": true,
+				"missing": nil,
+			},
+			yaml: "count: 3\nenabled: true\nkind: \"Secret\"\nmissing: null\nratio: 1.5\n",
+		},
+		{
+			name: "nested collections",
+			object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "db", "labels": map[string]string{}},
+				"items":    []interface{}{map[string]interface{}{"kind": "ConfigMap"}, "plain"},
+				"empty":    []string{},
+			},
+			yaml: "empty: []\n" +
+				"items:\n" +
+				"  -\n" +
+				"    kind: \"ConfigMap\"\n" +
+				"  - \"plain\"\n" +
+				"metadata:\n" +
+				"  labels: {}\n" +
+				"  name: \"db\"\n",
+		},
+		{
+			name: "keys and strings needing quotes",
+			object: map[string]string{
+				"MYSQL_PASSWORD": "it's: \"quoted\"\n#",
+				"yes":            "no",
+				"1st":            "true",
+				"a key":          "null",
+			},
+			yaml: "\"1st\": \"true\"\n" +
+				"MYSQL_PASSWORD: \"it's: \\\"quoted\\\"\\n#\"\n" +
+				"\"a key\": \"null\"\n" +
+				"\"yes\": \"no\"\n",
+		},
+		{
+			name:   "large numbers keep their digits",
+			object: map[string]interface{}{"size": int64(9007199254740993)},
+			yaml:   "size: 9007199254740993\n",
+		},
+	}
+
+	for _, test := range tests {
+		yaml, err := toYaml(test.object)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if string(yaml) != test.yaml {
+			t.Errorf("%s: yaml is\n%s\nwant\n%s", test.name, yaml, test.yaml)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package web_server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/metrics"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+// Service broker API routes whose responses are counted as operation
+// outcomes, by route name.
+var operationRoutes = map[string]string{
+	"provision":   "provision",
+	"update":      "update",
+	"deprovision": "deprovision",
+	"bind":        "bind",
+	"unbind":      "unbind",
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// metricsHandler counts and times the requests handled by next, labelled
+// with the name of the route of router they match.
+func metricsHandler(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "not_found"
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route.GetName() != "" {
+			route = match.Route.GetName()
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		metrics.Requests.Inc(route, r.Method, strconv.Itoa(recorder.status))
+		metrics.RequestDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+
+		if operation, ok := operationRoutes[route]; ok {
+			metrics.Operations.Inc(operation, metrics.StatusOutcome(recorder.status))
+		}
+	})
+}
+
+// registerMetrics registers the gauges that are computed from the state of
+// the controller and the backend server on every scrape.
+func (c *Controller) registerMetrics() {
+	metrics.Register(metrics.NewGaugeFunc("broker_jobs_in_progress",
+		"Number of background operations in progress by kind.",
+		c.jobsInProgress, "kind"))
+
+	metrics.Register(metrics.NewGaugeFunc("broker_admin_db_connections",
+		"Connections of the admin database pool by state.",
+		adminPoolStats, "state"))
+
+	metrics.Register(metrics.NewGaugeFunc("broker_instance_size_bytes",
+		"Size of the data and indexes of a service instance's database.",
+		c.instanceSizes, "instance_id", "plan_id"))
+
+	metrics.Register(metrics.NewGaugeFunc("broker_instance_connections",
+		"Number of open connections to a service instance's database.",
+		c.instanceConnections, "instance_id", "plan_id"))
+}
+
+// Private instance methods
+
+func (c *Controller) jobsInProgress() []metrics.GaugeValue {
+	operations := 0
+	for _, instance := range c.listInstances() {
+		if instance.Operation != "" {
+			operations++
+		}
+	}
+
+	backups := 0
+	for _, b := range c.backups.List("") {
+		if b.State == model.BACKUP_STATE_IN_PROGRESS {
+			backups++
+		}
+	}
+
+	return []metrics.GaugeValue{
+		{LabelValues: []string{"instance_operation"}, Value: float64(operations)},
+		{LabelValues: []string{"backup"}, Value: float64(backups)},
+	}
+}
+
+func (c *Controller) instanceSizes() []metrics.GaugeValue {
+	sizes, err := client.DatabaseSizes()
+	if err != nil {
+		logger.Error("reading database sizes failed", "err", err)
+		return nil
+	}
+
+	var values []metrics.GaugeValue
+	for _, instance := range c.listInstances() {
+		values = append(values, metrics.GaugeValue{
+			LabelValues: []string{instance.Id, instance.PlanId},
+			Value:       float64(sizes[instance.InternalId]),
+		})
+	}
+	return values
+}
+
+func (c *Controller) instanceConnections() []metrics.GaugeValue {
+	connections, err := client.DatabaseConnections()
+	if err != nil {
+		logger.Error("reading database connections failed", "err", err)
+		return nil
+	}
+
+	var values []metrics.GaugeValue
+	for _, instance := range c.listInstances() {
+		values = append(values, metrics.GaugeValue{
+			LabelValues: []string{instance.Id, instance.PlanId},
+			Value:       float64(connections[instance.InternalId]),
+		})
+	}
+	return values
+}
+
+func adminPoolStats() []metrics.GaugeValue {
+	stats := client.DB.Stats()
+	return []metrics.GaugeValue{
+		{LabelValues: []string{"open"}, Value: float64(stats.OpenConnections)},
+		{LabelValues: []string{"in_use"}, Value: float64(stats.InUse)},
+		{LabelValues: []string{"idle"}, Value: float64(stats.Idle)},
+	}
+}
@@ -0,0 +1,170 @@
+package web_server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/context"
+
+	brokerErrors "github.com/asiainfoLDP/datafactory-servicebroker-mysql/errors"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+const (
+	BROKER_API_VERSION_HEADER   = "X-Broker-API-Version"
+	ORIGINATING_IDENTITY_HEADER = "X-Broker-API-Originating-Identity"
+
+	DEFAULT_MIN_BROKER_API_VERSION = "2.6"
+)
+
+type contextKey int
+
+const (
+	apiVersionKey contextKey = iota
+	originatingIdentityKey
+	requestLoggerKey
+	requestIdKey
+)
+
+// ApiVersion is a parsed X-Broker-API-Version header value, e.g. 2.14.
+type ApiVersion struct {
+	Major int
+	Minor int
+}
+
+// Retrievable instances and bindings were introduced in 2.14, older platforms
+// poll GET /v2/service_instances/{id} for the last operation instead.
+var fetchableApiVersion = ApiVersion{Major: 2, Minor: 14}
+
+// Since 2.7 the last operation endpoint returns the state and description at
+// the top level instead of wrapped in a last_operation object.
+var flatLastOperationApiVersion = ApiVersion{Major: 2, Minor: 7}
+
+func ParseApiVersion(s string) (ApiVersion, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) != 2 {
+		return ApiVersion{}, fmt.Errorf("invalid broker api version: %q", s)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return ApiVersion{}, fmt.Errorf("invalid broker api version: %q", s)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ApiVersion{}, fmt.Errorf("invalid broker api version: %q", s)
+	}
+
+	return ApiVersion{Major: major, Minor: minor}, nil
+}
+
+func (v ApiVersion) Less(other ApiVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	return v.Minor < other.Minor
+}
+
+func (v ApiVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// brokerApiHandler rejects requests whose X-Broker-API-Version is missing or
+// older than the configured minimum and decodes the originating identity of
+// the platform user, if any, before handing the request to next.
+func brokerApiHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		minVersion, err := minBrokerApiVersion()
+		if err != nil {
+			writeBrokerError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		header := r.Header.Get(BROKER_API_VERSION_HEADER)
+		if header == "" {
+			writeBrokerError(w, http.StatusPreconditionFailed, fmt.Errorf("missing %s header", BROKER_API_VERSION_HEADER))
+			return
+		}
+
+		version, err := ParseApiVersion(header)
+		if err != nil {
+			writeBrokerError(w, http.StatusPreconditionFailed, err)
+			return
+		}
+		if version.Less(minVersion) {
+			writeBrokerError(w, http.StatusPreconditionFailed, fmt.Errorf("broker api version %s is not supported, minimum is %s", version, minVersion))
+			return
+		}
+		context.Set(r, apiVersionKey, version)
+
+		if header := r.Header.Get(ORIGINATING_IDENTITY_HEADER); header != "" {
+			identity, err := parseOriginatingIdentity(header)
+			if err != nil {
+				writeBrokerError(w, http.StatusBadRequest, err)
+				return
+			}
+			context.Set(r, originatingIdentityKey, identity)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func apiVersionFromRequest(r *http.Request) ApiVersion {
+	if version, ok := context.Get(r, apiVersionKey).(ApiVersion); ok {
+		return version
+	}
+	version, _ := ParseApiVersion(DEFAULT_MIN_BROKER_API_VERSION)
+	return version
+}
+
+func originatingIdentityFromRequest(r *http.Request) *model.OriginatingIdentity {
+	identity, _ := context.Get(r, originatingIdentityKey).(*model.OriginatingIdentity)
+	return identity
+}
+
+// Private methods
+
+func minBrokerApiVersion() (ApiVersion, error) {
+	if conf.MinBrokerApiVersion == "" {
+		return ParseApiVersion(DEFAULT_MIN_BROKER_API_VERSION)
+	}
+	return ParseApiVersion(conf.MinBrokerApiVersion)
+}
+
+// The header has the form "<platform> <base64 encoded json object>".
+func parseOriginatingIdentity(header string) (*model.OriginatingIdentity, error) {
+	parts := strings.Fields(header)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed " + ORIGINATING_IDENTITY_HEADER + " header")
+	}
+
+	value, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("malformed %s header: %s", ORIGINATING_IDENTITY_HEADER, err.Error()))
+	}
+
+	identity := model.OriginatingIdentity{Platform: parts[0]}
+	if err := json.Unmarshal(value, &identity.Value); err != nil {
+		return nil, errors.New(fmt.Sprintf("malformed %s header: %s", ORIGINATING_IDENTITY_HEADER, err.Error()))
+	}
+
+	return &identity, nil
+}
+
+func writeBrokerError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write([]byte(brokerErrors.NewBrokerError(err).ToJson()))
+}
+
+func writeBrokerErrorWithCode(w http.ResponseWriter, code int, errorCode string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write([]byte(brokerErrors.NewBrokerErrorWithCode(errorCode, err).ToJson()))
+}
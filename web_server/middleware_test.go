@@ -0,0 +1,53 @@
+package web_server
+
+import (
+	"testing"
+)
+
+func TestParseApiVersion(t *testing.T) {
+	tests := []struct {
+		header  string
+		version ApiVersion
+		valid   bool
+	}{
+		{"2.14", ApiVersion{Major: 2, Minor: 14}, true},
+		{"2.7", ApiVersion{Major: 2, Minor: 7}, true},
+		{" 2.13 ", ApiVersion{Major: 2, Minor: 13}, true},
+		{"3.0", ApiVersion{Major: 3, Minor: 0}, true},
+		{"", ApiVersion{}, false},
+		{"2", ApiVersion{}, false},
+		{"2.14.1", ApiVersion{}, false},
+		{"two.14", ApiVersion{}, false},
+		{"2.x", ApiVersion{}, false},
+	}
+
+	for _, test := range tests {
+		version, err := ParseApiVersion(test.header)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseApiVersion(%q) error = %v, want valid %v", test.header, err, test.valid)
+			continue
+		}
+		if version != test.version {
+			t.Errorf("ParseApiVersion(%q) = %v, want %v", test.header, version, test.version)
+		}
+	}
+}
+
+func TestApiVersionLess(t *testing.T) {
+	tests := []struct {
+		v, other ApiVersion
+		less     bool
+	}{
+		{ApiVersion{2, 13}, ApiVersion{2, 14}, true},
+		{ApiVersion{2, 14}, ApiVersion{2, 14}, false},
+		{ApiVersion{2, 15}, ApiVersion{2, 14}, false},
+		{ApiVersion{1, 99}, ApiVersion{2, 0}, true},
+		{ApiVersion{3, 0}, ApiVersion{2, 99}, false},
+	}
+
+	for _, test := range tests {
+		if less := test.v.Less(test.other); less != test.less {
+			t.Errorf("%v.Less(%v) = %v, want %v", test.v, test.other, less, test.less)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package web_server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const BYTES_PER_MB = 1024 * 1024
+
+// quotaScope is a quota policy and the tenant it applies to.
+type quotaScope struct {
+	scope  string
+	id     string
+	policy config.QuotaPolicy
+}
+
+// QuotaUsages returns every configured quota policy along with how much of
+// it its tenant uses, sorted by scope and id.
+func (c *Controller) QuotaUsages(log *logger.Logger) []*model.QuotaUsage {
+	sizes, err := client.DatabaseSizes()
+	if err != nil {
+		log.Warn("reading database sizes failed", "err", err)
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	usages := make([]*model.QuotaUsage, 0)
+	for _, s := range configuredQuotaScopes() {
+		usages = append(usages, c.quotaUsage(s, sizes))
+	}
+	sort.Sort(usagesByScope(usages))
+
+	return usages
+}
+
+// AdminListQuotas lists the quota policies matching the scope and id query
+// parameters along with their usage.
+func (c *Controller) AdminListQuotas(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin list quotas")
+
+	query := r.URL.Query()
+	usages := make([]*model.QuotaUsage, 0)
+	for _, usage := range c.QuotaUsages(log) {
+		if (query.Get("scope") == "" || query.Get("scope") == usage.Scope) &&
+			(query.Get("id") == "" || query.Get("id") == usage.Id) {
+			usages = append(usages, usage)
+		}
+	}
+
+	utils.WriteResponse(w, http.StatusOK, usages)
+}
+
+// Private instance methods
+
+// quotaViolation describes the first quota that provisioning or undeleting
+// instance would exceed, or returns an empty string if it fits into all of
+// them. The instance counts against the instance limits, storage limits are
+// only exceeded once the existing databases use up the storage. sizes are the
+// database sizes from quotaDatabaseSizes. Must be called with c.lock held.
+func (c *Controller) quotaViolation(instance *model.ServiceInstance, sizes map[string]int64) string {
+	scopes := instanceQuotaScopes(instance)
+
+	for _, s := range scopes {
+		usage := c.quotaUsage(s, sizes)
+		for _, plan := range usage.Instances {
+			if plan.PlanId != model.QUOTA_ALL_PLANS && plan.PlanId != instance.PlanId {
+				continue
+			}
+			if plan.Used >= plan.Limit {
+				if plan.PlanId == model.QUOTA_ALL_PLANS {
+					return fmt.Sprintf("Quota exceeded: %s %s may have at most %d service instances, it has %d",
+						s.scope, s.id, plan.Limit, plan.Used)
+				}
+				return fmt.Sprintf("Quota exceeded: %s %s may have at most %d service instances of plan %s, it has %d",
+					s.scope, s.id, plan.Limit, plan.PlanId, plan.Used)
+			}
+		}
+
+		if s.policy.MaxStorageMB > 0 && usage.StorageBytes >= s.policy.MaxStorageMB*BYTES_PER_MB {
+			return fmt.Sprintf("Quota exceeded: %s %s may use at most %d MB of storage, it uses %d MB",
+				s.scope, s.id, s.policy.MaxStorageMB, usage.StorageBytes/BYTES_PER_MB)
+		}
+	}
+
+	return ""
+}
+
+// Must be called with c.lock held.
+func (c *Controller) quotaUsage(s quotaScope, sizes map[string]int64) *model.QuotaUsage {
+	usage := &model.QuotaUsage{
+		Scope:        s.scope,
+		Id:           s.id,
+		Instances:    make([]*model.PlanQuotaUsage, 0, len(s.policy.MaxInstances)),
+		MaxStorageMB: s.policy.MaxStorageMB,
+	}
+
+	counts := make(map[string]int)
+	for _, instance := range c.instanceMap {
+		if !s.covers(instance) {
+			continue
+		}
+		counts[instance.PlanId]++
+		counts[model.QUOTA_ALL_PLANS]++
+		usage.StorageBytes += sizes[instance.InternalId]
+	}
+
+	for planId, limit := range s.policy.MaxInstances {
+		usage.Instances = append(usage.Instances, &model.PlanQuotaUsage{PlanId: planId, Limit: limit, Used: counts[planId]})
+	}
+	sort.Sort(planUsagesById(usage.Instances))
+
+	return usage
+}
+
+func (s quotaScope) covers(instance *model.ServiceInstance) bool {
+	switch s.scope {
+	case model.QUOTA_SCOPE_ORGANIZATION:
+		return instance.OrganizationGuid == s.id
+	case model.QUOTA_SCOPE_SPACE:
+		return instance.SpaceGuid == s.id
+	case model.QUOTA_SCOPE_NAMESPACE:
+		return instance.Context != nil && instance.Context.Platform == model.PLATFORM_KUBERNETES &&
+			instance.Context.Namespace == s.id
+	}
+	return false
+}
+
+// Private methods
+
+// quotaDatabaseSizes reads the database sizes if a storage quota applies to
+// instance, or returns nil if none does.
+func quotaDatabaseSizes(instance *model.ServiceInstance) (map[string]int64, error) {
+	for _, s := range instanceQuotaScopes(instance) {
+		if s.policy.MaxStorageMB > 0 {
+			sizes, err := client.DatabaseSizes()
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Could not check the storage quota, message: %s", err.Error()))
+			}
+			return sizes, nil
+		}
+	}
+	return nil, nil
+}
+
+// instanceQuotaScopes returns the quota policies that apply to instance.
+func instanceQuotaScopes(instance *model.ServiceInstance) []quotaScope {
+	var scopes []quotaScope
+	for _, s := range configuredQuotaScopes() {
+		if s.covers(instance) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func configuredQuotaScopes() []quotaScope {
+	var scopes []quotaScope
+	for id, policy := range conf.Quotas.Organizations {
+		scopes = append(scopes, quotaScope{model.QUOTA_SCOPE_ORGANIZATION, id, policy})
+	}
+	for id, policy := range conf.Quotas.Spaces {
+		scopes = append(scopes, quotaScope{model.QUOTA_SCOPE_SPACE, id, policy})
+	}
+	for id, policy := range conf.Quotas.Namespaces {
+		scopes = append(scopes, quotaScope{model.QUOTA_SCOPE_NAMESPACE, id, policy})
+	}
+	return scopes
+}
+
+func validateQuotas() error {
+	for _, s := range configuredQuotaScopes() {
+		for planId, limit := range s.policy.MaxInstances {
+			if limit < 0 {
+				return errors.New(fmt.Sprintf("Invalid quota for %s %s: max_instances of plan %s is negative", s.scope, s.id, planId))
+			}
+		}
+		if s.policy.MaxStorageMB < 0 {
+			return errors.New(fmt.Sprintf("Invalid quota for %s %s: max_storage_mb is negative", s.scope, s.id))
+		}
+	}
+	return nil
+}
+
+type usagesByScope []*model.QuotaUsage
+
+func (a usagesByScope) Len() int      { return len(a) }
+func (a usagesByScope) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a usagesByScope) Less(i, j int) bool {
+	if a[i].Scope != a[j].Scope {
+		return a[i].Scope < a[j].Scope
+	}
+	return a[i].Id < a[j].Id
+}
+
+type planUsagesById []*model.PlanQuotaUsage
+
+func (a planUsagesById) Len() int           { return len(a) }
+func (a planUsagesById) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a planUsagesById) Less(i, j int) bool { return a[i].PlanId < a[j].PlanId }
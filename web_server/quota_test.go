@@ -0,0 +1,90 @@
+package web_server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+func TestQuotaViolation(t *testing.T) {
+	saved := conf.Quotas
+	defer func() { conf.Quotas = saved }()
+	conf.Quotas = config.QuotaConfig{
+		Organizations: map[string]config.QuotaPolicy{
+			"org": {MaxInstances: map[string]int{model.QUOTA_ALL_PLANS: 3}, MaxStorageMB: 10},
+		},
+		Spaces: map[string]config.QuotaPolicy{
+			"space": {MaxInstances: map[string]int{"small": 1}},
+		},
+	}
+
+	existing := func(id, org, space, plan string) *model.ServiceInstance {
+		return &model.ServiceInstance{Id: id, InternalId: id, OrganizationGuid: org, SpaceGuid: space, PlanId: plan}
+	}
+	tests := []struct {
+		name      string
+		instances []*model.ServiceInstance
+		sizes     map[string]int64
+		instance  *model.ServiceInstance
+		violation string
+	}{
+		{
+			"no quota applies",
+			[]*model.ServiceInstance{existing("a", "other", "other", "small")},
+			nil,
+			existing("new", "other", "other", "small"),
+			"",
+		},
+		{
+			"within every limit",
+			[]*model.ServiceInstance{existing("a", "org", "space", "large")},
+			map[string]int64{"a": 5 * BYTES_PER_MB},
+			existing("new", "org", "space", "small"),
+			"",
+		},
+		{
+			"organization instance limit",
+			[]*model.ServiceInstance{existing("a", "org", "x", "large"), existing("b", "org", "y", "large"), existing("c", "org", "z", "small")},
+			nil,
+			existing("new", "org", "other", "large"),
+			"organization org may have at most 3 service instances, it has 3",
+		},
+		{
+			"organization storage limit",
+			[]*model.ServiceInstance{existing("a", "org", "x", "large")},
+			map[string]int64{"a": 10 * BYTES_PER_MB},
+			existing("new", "org", "other", "large"),
+			"organization org may use at most 10 MB of storage, it uses 10 MB",
+		},
+		{
+			"space plan limit",
+			[]*model.ServiceInstance{existing("a", "other", "space", "small")},
+			nil,
+			existing("new", "other", "space", "small"),
+			"space space may have at most 1 service instances of plan small, it has 1",
+		},
+		{
+			"space plan limit of another plan",
+			[]*model.ServiceInstance{existing("a", "other", "space", "small")},
+			nil,
+			existing("new", "other", "space", "large"),
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		controller := &Controller{instanceMap: make(map[string]*model.ServiceInstance)}
+		for _, instance := range test.instances {
+			controller.instanceMap[instance.Id] = instance
+		}
+
+		violation := controller.quotaViolation(test.instance, test.sizes)
+		if test.violation == "" && violation != "" {
+			t.Errorf("%s: violation %q, want none", test.name, violation)
+		} else if !strings.HasSuffix(violation, test.violation) {
+			t.Errorf("%s: violation %q, want %q", test.name, violation, test.violation)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package web_server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+const OPERATION_RESTORE = "restore"
+
+// restoreSource returns the backup to provision instance from. The backup
+// must have succeeded and its instance, which may have been deleted since,
+// must belong to the same Cloud Foundry organization or Kubernetes namespace
+// as instance. Must be called with c.lock held.
+func (c *Controller) restoreSource(instance *model.ServiceInstance, backupId string) (*model.Backup, error) {
+	backup, err := c.backups.Get(backupId)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid %s: %s", RESTORE_FROM_PARAMETER, err.Error()))
+	}
+	if backup.State != model.BACKUP_STATE_SUCCEEDED {
+		return nil, errors.New(fmt.Sprintf("Invalid %s: backup %s is %s", RESTORE_FROM_PARAMETER, backupId, backup.State))
+	}
+
+	owner := c.instanceMap[backup.InstanceId]
+	if deleted, ok := c.deletedMap[backup.InstanceId]; owner == nil && ok {
+		owner = deleted.Instance
+	}
+	if owner == nil {
+		// Without the instance there is no telling whose data it is.
+		return nil, errors.New(fmt.Sprintf("Invalid %s: the service instance of backup %s no longer exists", RESTORE_FROM_PARAMETER, backupId))
+	}
+
+	if owner.OrganizationGuid != instance.OrganizationGuid || !sameNamespace(owner.Context, instance.Context) {
+		return nil, errors.New(fmt.Sprintf("Invalid %s: backup %s belongs to another tenant", RESTORE_FROM_PARAMETER, backupId))
+	}
+
+	return backup, nil
+}
+
+// startRestore restores a backup into the database of the instance in the
+// background, reporting the outcome through the instance's last operation.
+func (c *Controller) startRestore(log *logger.Logger, instanceId, backupId, database string) {
+	log = log.With("instance_id", instanceId, "backup_id", backupId)
+
+	c.jobs.Add(1)
+	go func() {
+		defer c.jobs.Done()
+
+		// The backup manager logs the restore and counts it in the metrics.
+		err := c.backups.Restore(backupId, database)
+		c.notifyAsyncProvision(instanceId, err)
+		if err != nil {
+			log.Error("provisioning from a backup failed", "err", err)
+			c.setLastOperation(instanceId, model.LAST_OPERATION_FAILED,
+				fmt.Sprintf("failed to restore backup %s: %s", backupId, err.Error()), true)
+			return
+		}
+
+		c.setLastOperation(instanceId, model.LAST_OPERATION_SUCCEEDED,
+			fmt.Sprintf("successfully restored backup %s", backupId), true)
+	}()
+}
@@ -1,18 +1,26 @@
 package web_server
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
+	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/audit"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/backup"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
 	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/metrics"
 	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
 	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
-
-	"log"
 )
 
 var (
@@ -22,54 +30,218 @@ var (
 
 type Server struct {
 	controller *Controller
+	httpServer *http.Server
+	tlsConfig  *tls.Config
 }
 
 func CreateServer(cloudName string) (*Server, error) {
-	serviceInstances, err := loadServiceInstances()
+	Ctl, err := OpenController(cloudName)
 	if err != nil {
 		return nil, err
 	}
 
-	serviceBindings, err := loadServiceBindings()
+	if err := Ctl.failInterruptedOperations(); err != nil {
+		return nil, err
+	}
+
+	if err := Ctl.backups.FailInterrupted(); err != nil {
+		return nil, err
+	}
+
+	if _, err := softDeleteGracePeriod(); err != nil {
+		return nil, err
+	}
+
+	if _, err := shutdownTimeout(); err != nil {
+		return nil, err
+	}
+
+	if err := validateQuotas(); err != nil {
+		return nil, err
+	}
+
+	if _, err := usageSampleInterval(); err != nil {
+		return nil, err
+	}
+
+	if err := validateDashboard(); err != nil {
+		return nil, err
+	}
+
+	if err := validatePlanOptions(); err != nil {
+		return nil, err
+	}
+
+	Ctl.backupScheduler, err = backup.NewScheduler(Ctl.backups, Ctl.listInstances, conf.BackupPolicies)
 	if err != nil {
 		return nil, err
 	}
 
-	serviceCredentials, err := loadServiceCredentials()
+	Ctl.audit, err = loadAuditLog()
 	if err != nil {
 		return nil, err
 	}
 
-	Ctl, err := CreateController(cloudName, serviceInstances, serviceBindings, serviceCredentials)
+	Ctl.webhooks, err = loadWebhookNotifier()
 	if err != nil {
 		return nil, err
 	}
 
+	Ctl.registerMetrics()
+
+	var tlsConfig *tls.Config
+	if tlsEnabled() {
+		tlsConfig, err = newTLSConfig(conf.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	controller = Ctl
 	return &Server{
 		controller: Ctl,
+		tlsConfig:  tlsConfig,
 	}, nil
 }
 
-func (s *Server) Start() {
+// OpenController connects to the backend server and loads the store, without
+// starting any background job. The operator commands use it to work on the
+// store directly.
+func OpenController(cloudName string) (*Controller, error) {
+	if err := client.Open(conf.MysqlTLS); err != nil {
+		return nil, err
+	}
+
+	serviceInstances, err := loadServiceInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	serviceBindings, err := loadServiceBindings()
+	if err != nil {
+		return nil, err
+	}
+
+	serviceCredentials, err := loadServiceCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	Ctl, err := CreateController(cloudName, serviceInstances, serviceBindings, serviceCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	Ctl.deletedMap, err = loadDeletedInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	Ctl.suspensionMap, err = loadSuspensions()
+	if err != nil {
+		return nil, err
+	}
+
+	Ctl.backups, err = loadBackupManager()
+	if err != nil {
+		return nil, err
+	}
+
+	Ctl.usage, err = loadUsageLog()
+	if err != nil {
+		return nil, err
+	}
+
+	return Ctl, nil
+}
+
+// Start serves the broker until it receives SIGINT or SIGTERM, then shuts it
+// down gracefully. It returns once the shutdown is complete.
+func (s *Server) Start() error {
 	router := mux.NewRouter()
 
-	router.HandleFunc("/v2/catalog", s.controller.Catalog).Methods("GET")
-	router.HandleFunc("/v2/service_instances/{service_instance_guid}", s.controller.GetServiceInstance).Methods("GET")
-	router.HandleFunc("/v2/service_instances/{service_instance_guid}", s.controller.CreateServiceInstance).Methods("PUT")
-	router.HandleFunc("/v2/service_instances/{service_instance_guid}", s.controller.RemoveServiceInstance).Methods("DELETE")
-	router.HandleFunc("/v2/service_instances/{service_instance_guid}/service_bindings/{service_binding_guid}", s.controller.Bind).Methods("PUT")
-	router.HandleFunc("/v2/service_instances/{service_instance_guid}/service_bindings/{service_binding_guid}", s.controller.UnBind).Methods("DELETE")
+	router.HandleFunc("/v2/catalog", s.controller.Catalog).Methods("GET").Name("catalog")
+	router.HandleFunc("/v2/service_instances/{service_instance_guid}", s.controller.GetServiceInstance).Methods("GET").Name("get_instance")
+	router.HandleFunc("/v2/service_instances/{service_instance_guid}/last_operation", s.controller.GetLastOperation).Methods("GET").Name("last_operation")
+	router.HandleFunc("/v2/service_instances/{service_instance_guid}", s.controller.CreateServiceInstance).Methods("PUT").Name("provision")
+	router.HandleFunc("/v2/service_instances/{service_instance_guid}", s.controller.UpdateServiceInstance).Methods("PATCH").Name("update")
+	router.HandleFunc("/v2/service_instances/{service_instance_guid}", s.controller.RemoveServiceInstance).Methods("DELETE").Name("deprovision")
+	router.HandleFunc("/v2/service_instances/{service_instance_guid}/service_bindings/{service_binding_guid}", s.controller.GetServiceBinding).Methods("GET").Name("get_binding")
+	router.HandleFunc("/v2/service_instances/{service_instance_guid}/service_bindings/{service_binding_guid}", s.controller.Bind).Methods("PUT").Name("bind")
+	router.HandleFunc("/v2/service_instances/{service_instance_guid}/service_bindings/{service_binding_guid}", s.controller.UnBind).Methods("DELETE").Name("unbind")
+
+	router.HandleFunc("/healthz", s.controller.Healthz).Methods("GET")
+	router.HandleFunc(DASHBOARD_PATH+"{service_instance_guid}", s.controller.Dashboard).Methods("GET")
+	router.HandleFunc(DASHBOARD_SSO_CALLBACK_PATH, s.controller.DashboardSignInCallback).Methods("GET")
+	router.HandleFunc("/readyz", s.controller.Readyz).Methods("GET")
+
+	router.HandleFunc("/admin/instances", s.controller.AdminListInstances).Methods("GET")
+	router.HandleFunc("/admin/instances/{service_instance_guid}", s.controller.AdminGetInstance).Methods("GET")
+	router.HandleFunc("/admin/instances/{service_instance_guid}/rotate_credentials", s.controller.AdminRotateCredentials).Methods("POST").Name("admin_rotate_credentials")
+	router.HandleFunc("/admin/instances/{service_instance_guid}/resync", s.controller.AdminResyncInstance).Methods("POST").Name("admin_resync")
+	router.HandleFunc("/admin/instances/{service_instance_guid}/force_delete", s.controller.AdminForceDeleteInstance).Methods("POST").Name("admin_force_delete")
+	router.HandleFunc("/admin/instances/{service_instance_guid}/suspend", s.controller.AdminSuspendInstance).Methods("POST").Name("admin_suspend")
+	router.HandleFunc("/admin/instances/{service_instance_guid}/resume", s.controller.AdminResumeInstance).Methods("POST").Name("admin_resume")
+	router.HandleFunc("/admin/bindings", s.controller.AdminListBindings).Methods("GET")
+	router.HandleFunc("/admin/quotas", s.controller.AdminListQuotas).Methods("GET")
+	router.HandleFunc("/admin/instances/{service_instance_guid}/backups", s.controller.AdminListBackups).Methods("GET")
+	router.HandleFunc("/admin/instances/{service_instance_guid}/backups", s.controller.AdminCreateBackup).Methods("POST").Name("admin_create_backup")
+	router.HandleFunc("/admin/instances/{service_instance_guid}/restore", s.controller.AdminRestoreBackup).Methods("POST").Name("admin_restore")
+	router.HandleFunc("/admin/deleted_instances", s.controller.AdminListDeletedInstances).Methods("GET")
+	router.HandleFunc("/admin/deleted_instances/{service_instance_guid}/undelete", s.controller.AdminUndeleteInstance).Methods("POST").Name("admin_undelete")
+	router.HandleFunc("/admin/deleted_instances/{service_instance_guid}", s.controller.AdminPurgeInstance).Methods("DELETE").Name("admin_purge")
+	router.HandleFunc("/admin/backups", s.controller.AdminListBackups).Methods("GET")
+	router.HandleFunc("/admin/backup_schedules", s.controller.AdminBackupSchedules).Methods("GET")
+	router.HandleFunc("/admin/backups/{backup_id}", s.controller.AdminGetBackup).Methods("GET")
+	router.HandleFunc("/admin/backups/{backup_id}", s.controller.AdminDeleteBackup).Methods("DELETE").Name("admin_delete_backup")
+	router.HandleFunc("/admin/audit_events", s.controller.AdminListAuditEvents).Methods("GET")
+	router.HandleFunc("/admin/usage_events", s.controller.AdminListUsageEvents).Methods("GET")
+	router.HandleFunc("/admin/bindings/{service_binding_guid}/manifest", s.controller.AdminGetBindingManifest).Methods("GET").Name("admin_binding_manifest")
 
-	http.Handle("/", router)
+	// The middlewares store values in the request context before the router
+	// is reached, and requests they reject never get to the router clearing
+	// it, so clear it once the whole chain is done.
+	http.Handle("/v2/", context.ClearHandler(loggingHandler(metricsHandler(router, brokerApiHandler(webhookHandler(router, s.controller.webhooks, auditHandler(router, s.controller.audit, router)))))))
+	http.Handle("/admin/", context.ClearHandler(loggingHandler(adminHandler(auditHandler(router, s.controller.audit, router)))))
+	http.Handle("/metrics", metrics.Handler())
+	http.Handle("/", context.ClearHandler(loggingHandler(router)))
 
 	cfPort := os.Getenv("PORT")
 	if cfPort != "" {
 		conf.Port = cfPort
 	}
 
-	fmt.Println("Server started, listening on port " + conf.Port + "...")
-	log.Println(http.ListenAndServe(":"+conf.Port, nil))
+	s.controller.backupScheduler.Start()
+	s.controller.webhooks.Start()
+	s.controller.startPurger()
+	interval, _ := usageSampleInterval()
+	s.controller.startUsageSampler(interval)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	s.httpServer = &http.Server{Addr: ":" + conf.Port, TLSConfig: s.tlsConfig}
+	served := make(chan error, 1)
+	go func() {
+		if s.tlsConfig != nil {
+			// The certificates come from the TLS configuration.
+			served <- s.httpServer.ListenAndServeTLS("", "")
+		} else {
+			served <- s.httpServer.ListenAndServe()
+		}
+	}()
+	logger.Info("server started", "port", conf.Port, "tls", s.tlsConfig != nil)
+
+	select {
+	case err := <-served:
+		logger.Error("server stopped", "err", err)
+		s.Shutdown()
+		return err
+	case sig := <-signals:
+		logger.Info("shutting down", "signal", sig.String())
+	}
+
+	return s.Shutdown()
 }
 
 // private methods
@@ -79,7 +251,7 @@ func loadServiceInstances() (map[string]*model.ServiceInstance, error) {
 	err := utils.ReadAndUnmarshal(&serviceInstancesMap, conf.DataPath, conf.ServiceInstancesFileName)
 	if err != nil {
 		if os.IsNotExist(err) {
-			fmt.Printf("WARNING: service instance data file '%s' does not exist: \n", conf.ServiceInstancesFileName)
+			logger.Warn("service instance data file does not exist", "file", conf.ServiceInstancesFileName)
 			serviceInstancesMap = make(map[string]*model.ServiceInstance)
 		} else {
 			return nil, errors.New(fmt.Sprintf("Could not load the service instances, message: %s", err.Error()))
@@ -95,7 +267,7 @@ func loadServiceBindings() (map[string]*model.ServiceBinding, error) {
 	err := utils.ReadAndUnmarshal(&bindingMap, conf.DataPath, conf.ServiceBindingsFileName)
 	if err != nil {
 		if os.IsNotExist(err) {
-			fmt.Printf("WARNING: key map data file '%s' does not exist: \n", conf.ServiceBindingsFileName)
+			logger.Warn("service binding data file does not exist", "file", conf.ServiceBindingsFileName)
 			bindingMap = make(map[string]*model.ServiceBinding)
 		} else {
 			return nil, errors.New(fmt.Sprintf("Could not load the service instances, message: %s", err.Error()))
@@ -108,10 +280,10 @@ func loadServiceBindings() (map[string]*model.ServiceBinding, error) {
 func loadServiceCredentials() (map[string]*model.Credential, error) {
 	var credentialMap map[string]*model.Credential
 
-	err := utils.ReadAndUnmarshal(&credentialMap, conf.DataPath, conf.ServiceBindingsFileName)
+	err := utils.ReadAndUnmarshal(&credentialMap, conf.DataPath, conf.ServicdCredentialsFileName)
 	if err != nil {
 		if os.IsNotExist(err) {
-			fmt.Printf("WARNING: key map data file '%s' does not exist: \n", conf.ServiceBindingsFileName)
+			logger.Warn("service credential data file does not exist", "file", conf.ServicdCredentialsFileName)
 			credentialMap = make(map[string]*model.Credential)
 		} else {
 			return nil, errors.New(fmt.Sprintf("Could not load the service instances, message: %s", err.Error()))
@@ -120,3 +292,37 @@ func loadServiceCredentials() (map[string]*model.Credential, error) {
 
 	return credentialMap, nil
 }
+
+// validatePlanOptions refuses plans requiring SSL when the broker has no CA
+// of the backend server to hand out, as clients could not verify it.
+func validatePlanOptions() error {
+	for planId, options := range conf.PlanOptions {
+		if options.RequireSSL && conf.MysqlTLS.CAFile == "" {
+			return errors.New(fmt.Sprintf("Invalid options for plan %s: require_ssl needs the ca_file of mysql_tls", planId))
+		}
+	}
+	return nil
+}
+
+func loadBackupManager() (*backup.Manager, error) {
+	target, err := backup.NewTarget(conf.BackupTarget, conf.BackupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return backup.NewManager(client.DB, target, conf.DataPath, conf.BackupsFileName)
+}
+
+func loadAuditLog() (*audit.Log, error) {
+	fileName := conf.AuditLogFileName
+	if fileName == "" {
+		fileName = DEFAULT_AUDIT_LOG_FILE_NAME
+	}
+
+	sink, err := audit.NewSink(conf.AuditSink, filepath.Join(conf.DataPath, fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	return audit.NewLog(sink), nil
+}
@@ -0,0 +1,124 @@
+package web_server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+)
+
+const DEFAULT_SHUTDOWN_TIMEOUT = 30 * time.Second
+
+// Shutdown stops accepting requests, then waits for the requests being
+// handled and the background jobs to finish until the shutdown timeout is
+// over. It records the stores as they are then, so that operations that did
+// not finish are reported as interrupted after a restart. Once the jobs are
+// done it closes the audit and usage logs, the webhook dead letter file and
+// the admin database pool. Jobs still running keep using them until the
+// process exits.
+func (s *Server) Shutdown() error {
+	timeout, err := shutdownTimeout()
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+
+	var result error
+	if s.httpServer != nil {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			logger.Warn("requests still in flight at shutdown", "err", err)
+			result = err
+		}
+	}
+
+	drained := true
+	if err := s.controller.drain(deadline); err != nil {
+		logger.Warn("background jobs still running at shutdown", "err", err)
+		result = err
+		drained = false
+	}
+
+	if err := s.controller.checkpoint(); err != nil {
+		logger.Error("recording the stores at shutdown failed", "err", err)
+		result = err
+	}
+
+	if !drained {
+		logger.Info("server shut down, leaving the logs and the admin database pool to the jobs still running")
+		return result
+	}
+
+	if err := s.controller.audit.Close(); err != nil {
+		logger.Error("closing the audit log failed", "err", err)
+	}
+	if err := s.controller.usage.Close(); err != nil {
+		logger.Error("closing the usage log failed", "err", err)
+	}
+	if err := s.controller.webhooks.Close(); err != nil {
+		logger.Error("closing the webhook dead letter file failed", "err", err)
+	}
+	if err := client.DB.Close(); err != nil {
+		logger.Error("closing the admin database pool failed", "err", err)
+	}
+
+	logger.Info("server shut down")
+	return result
+}
+
+// Private instance methods
+
+// drain stops the backup scheduler, the purger and the usage sampler and
+// waits for them and for the clones and restores in progress to finish, or
+// gives up at deadline. Either way it then stops the webhooks, so that the
+// events not delivered yet, and those of the jobs still running, go to the
+// dead letter file.
+func (c *Controller) drain(deadline time.Time) error {
+	done := make(chan struct{})
+	go func() {
+		c.backupScheduler.Stop()
+		c.stopPurger()
+		c.stopUsageSampler()
+		c.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		c.webhooks.Stop()
+		return nil
+	case <-time.After(deadline.Sub(time.Now())):
+		c.webhooks.Stop()
+		return errors.New("timed out waiting for background jobs")
+	}
+}
+
+// checkpoint records the stores. Operations still running are recorded as
+// they are, the broker reports them as interrupted when it starts again, see
+// failInterruptedOperations; a job finishing before the process exits records
+// its own outcome.
+func (c *Controller) checkpoint() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.recordStores()
+}
+
+// Private methods
+
+func shutdownTimeout() (time.Duration, error) {
+	if conf.ShutdownTimeout == "" {
+		return DEFAULT_SHUTDOWN_TIMEOUT, nil
+	}
+
+	timeout, err := time.ParseDuration(conf.ShutdownTimeout)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid shutdown_timeout: %s", err.Error()))
+	}
+	return timeout, nil
+}
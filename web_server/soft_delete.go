@@ -0,0 +1,279 @@
+package web_server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	PURGE_INTERVAL = 10 * time.Minute
+
+	DELETED_DATABASE_PREFIX = "DEL"
+)
+
+// softDeleteInstance moves the database of an instance aside instead of
+// dropping it, and keeps the instance, its credential and its bindings in the
+// deleted instances store until the grace period is over. Must be called
+// with c.lock held.
+func (c *Controller) softDeleteInstance(log *logger.Logger, instance *model.ServiceInstance, gracePeriod time.Duration, finalBackupId string) error {
+	now := time.Now()
+	deleted := &model.DeletedInstance{
+		Instance:      instance,
+		Credential:    c.credentialMap[instance.Id],
+		Database:      fmt.Sprintf("%s_%d_%s", DELETED_DATABASE_PREFIX, now.Unix(), instance.InternalId),
+		FinalBackupId: finalBackupId,
+		DeletedAt:     now,
+		PurgeAt:       now.Add(gracePeriod),
+	}
+	for _, binding := range c.bindingMap {
+		if binding.ServiceInstanceId == instance.Id {
+			deleted.Bindings = append(deleted.Bindings, binding)
+		}
+	}
+
+	// The binding users keep their grants on the original name, so they lose
+	// access to the data once the database has been renamed.
+	if err := client.RenameDatabase(log, instance.InternalId, deleted.Database); err != nil {
+		return err
+	}
+	log.Info("service instance soft deleted", "instance_id", instance.Id, "database", deleted.Database, "purge_at", deleted.PurgeAt.Format(time.RFC3339))
+
+	c.deletedMap[instance.Id] = deleted
+	if err := utils.MarshalAndRecord(c.deletedMap, conf.DataPath, conf.DeletedInstancesFileName); err != nil {
+		return err
+	}
+
+	delete(c.credentialMap, instance.Id)
+	if err := utils.MarshalAndRecord(c.credentialMap, conf.DataPath, conf.ServicdCredentialsFileName); err != nil {
+		return err
+	}
+
+	delete(c.instanceMap, instance.Id)
+	if err := utils.MarshalAndRecord(c.instanceMap, conf.DataPath, conf.ServiceInstancesFileName); err != nil {
+		return err
+	}
+
+	return c.deleteAssociatedBindings(instance.Id)
+}
+
+func (c *Controller) AdminListDeletedInstances(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin list deleted instances")
+
+	c.lock.RLock()
+	deleted := make([]*model.DeletedInstance, 0, len(c.deletedMap))
+	for _, d := range c.deletedMap {
+		deleted = append(deleted, d)
+	}
+	sort.Sort(deletedByPurgeTime(deleted))
+	details := make([]*model.DeletedInstanceDetail, 0, len(deleted))
+	for _, d := range deleted {
+		details = append(details, d.Detail())
+	}
+	c.lock.RUnlock()
+
+	utils.WriteResponse(w, http.StatusOK, details)
+}
+
+// AdminUndeleteInstance brings a soft deleted instance back with its
+// database, credential and bindings as they were at deprovisioning.
+func (c *Controller) AdminUndeleteInstance(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin undelete instance")
+
+	instanceId := utils.ExtractVarsFromRequest(r, "service_instance_guid")
+	c.lock.RLock()
+	deleted, ok := c.deletedMap[instanceId]
+	c.lock.RUnlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// The instance counts against the quotas again, as if it was provisioned.
+	sizes, err := quotaDatabaseSizes(deleted.Instance)
+	if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// It may have been purged or undeleted meanwhile.
+	if deleted, ok = c.deletedMap[instanceId]; !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if _, exists := c.instanceMap[instanceId]; exists {
+		writeBrokerError(w, http.StatusConflict, errors.New(fmt.Sprintf("service instance %s has been provisioned again", instanceId)))
+		return
+	}
+	if violation := c.quotaViolation(deleted.Instance, sizes); violation != "" {
+		log.Info("undelete refused", "instance_id", instanceId, "reason", violation)
+		writeBrokerError(w, http.StatusUnprocessableEntity, errors.New(violation))
+		return
+	}
+
+	if err := client.RenameDatabase(log, deleted.Database, deleted.Instance.InternalId); err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.instanceMap[instanceId] = deleted.Instance
+	if deleted.Credential != nil {
+		c.credentialMap[instanceId] = deleted.Credential
+	}
+	for _, binding := range deleted.Bindings {
+		c.bindingMap[binding.Id] = binding
+	}
+	delete(c.deletedMap, instanceId)
+
+	for _, err := range []error{
+		utils.MarshalAndRecord(c.instanceMap, conf.DataPath, conf.ServiceInstancesFileName),
+		utils.MarshalAndRecord(c.credentialMap, conf.DataPath, conf.ServicdCredentialsFileName),
+		utils.MarshalAndRecord(c.bindingMap, conf.DataPath, conf.ServiceBindingsFileName),
+		utils.MarshalAndRecord(c.deletedMap, conf.DataPath, conf.DeletedInstancesFileName),
+	} {
+		if err != nil {
+			writeBrokerError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	log.Info("service instance undeleted", "instance_id", instanceId)
+	c.recordUsage(log, model.USAGE_STATE_CREATED, deleted.Instance)
+
+	utils.WriteResponse(w, http.StatusOK, deleted.Instance)
+}
+
+// AdminPurgeInstance drops a soft deleted instance right away, without
+// waiting for its grace period to end.
+func (c *Controller) AdminPurgeInstance(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin purge instance")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	instanceId := utils.ExtractVarsFromRequest(r, "service_instance_guid")
+	deleted, ok := c.deletedMap[instanceId]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := c.purgeInstance(log, deleted); err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusOK, "{}")
+}
+
+// Private instance methods
+
+func (c *Controller) startPurger() {
+	c.purgeStop = make(chan struct{})
+	c.purgeDone = make(chan struct{})
+
+	go func() {
+		defer close(c.purgeDone)
+
+		ticker := time.NewTicker(PURGE_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			c.purgeExpired(time.Now())
+
+			select {
+			case <-c.purgeStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *Controller) stopPurger() {
+	if c.purgeStop == nil {
+		return
+	}
+
+	close(c.purgeStop)
+	<-c.purgeDone
+}
+
+func (c *Controller) purgeExpired(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	log := logger.New("job", "purge")
+	for _, deleted := range c.deletedMap {
+		if now.Before(deleted.PurgeAt) {
+			continue
+		}
+		if err := c.purgeInstance(log, deleted); err != nil {
+			log.Error("purging service instance failed", "instance_id", deleted.Instance.Id, "err", err)
+		}
+	}
+}
+
+// Must be called with c.lock held.
+func (c *Controller) purgeInstance(log *logger.Logger, deleted *model.DeletedInstance) error {
+	if err := client.DropDatabase(log, deleted.Database); err != nil {
+		return err
+	}
+	if deleted.Credential != nil {
+		client.DropUser(log, deleted.Credential.Username)
+	}
+	log.Info("service instance purged", "instance_id", deleted.Instance.Id, "database", deleted.Database)
+
+	if err := c.forgetSuspension(deleted.Instance.Id); err != nil {
+		return err
+	}
+	delete(c.deletedMap, deleted.Instance.Id)
+	return utils.MarshalAndRecord(c.deletedMap, conf.DataPath, conf.DeletedInstancesFileName)
+}
+
+func softDeleteGracePeriod() (time.Duration, error) {
+	if conf.SoftDeleteGracePeriod == "" {
+		return 0, nil
+	}
+
+	gracePeriod, err := time.ParseDuration(conf.SoftDeleteGracePeriod)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid soft_delete_grace_period: %s", err.Error()))
+	}
+	return gracePeriod, nil
+}
+
+func loadDeletedInstances() (map[string]*model.DeletedInstance, error) {
+	var deletedMap map[string]*model.DeletedInstance
+
+	err := utils.ReadAndUnmarshal(&deletedMap, conf.DataPath, conf.DeletedInstancesFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Warn("deleted instance data file does not exist", "file", conf.DeletedInstancesFileName)
+			deletedMap = make(map[string]*model.DeletedInstance)
+		} else {
+			return nil, errors.New(fmt.Sprintf("Could not load the deleted service instances, message: %s", err.Error()))
+		}
+	}
+
+	return deletedMap, nil
+}
+
+type deletedByPurgeTime []*model.DeletedInstance
+
+func (a deletedByPurgeTime) Len() int           { return len(a) }
+func (a deletedByPurgeTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a deletedByPurgeTime) Less(i, j int) bool { return a[i].PurgeAt.Before(a[j].PurgeAt) }
@@ -0,0 +1,122 @@
+package web_server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+// ExportStore returns the whole store: instances, bindings, credentials,
+// soft deleted instances and backup records. Backup archives stay in the
+// backup target.
+func (c *Controller) ExportStore() *model.StoreExport {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return &model.StoreExport{
+		Version:          model.STORE_EXPORT_VERSION,
+		ExportedAt:       time.Now(),
+		Instances:        c.instanceMap,
+		Bindings:         c.bindingMap,
+		Credentials:      c.credentialMap,
+		DeletedInstances: c.deletedMap,
+		Suspensions:      c.suspensionMap,
+		Backups:          c.backups.List(""),
+	}
+}
+
+// ImportStore replaces the store with an export. It refuses to overwrite a
+// store that has instances unless replace is set.
+func (c *Controller) ImportStore(export *model.StoreExport, replace bool) error {
+	if export.Version != model.STORE_EXPORT_VERSION {
+		return errors.New(fmt.Sprintf("Unsupported store export version %d, expected %d", export.Version, model.STORE_EXPORT_VERSION))
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !replace && (len(c.instanceMap) > 0 || len(c.deletedMap) > 0) {
+		return errors.New(fmt.Sprintf("The store already has %d service instances and %d deleted instances, replace it explicitly", len(c.instanceMap), len(c.deletedMap)))
+	}
+
+	c.instanceMap = export.Instances
+	if c.instanceMap == nil {
+		c.instanceMap = make(map[string]*model.ServiceInstance)
+	}
+	c.bindingMap = export.Bindings
+	if c.bindingMap == nil {
+		c.bindingMap = make(map[string]*model.ServiceBinding)
+	}
+	c.credentialMap = export.Credentials
+	if c.credentialMap == nil {
+		c.credentialMap = make(map[string]*model.Credential)
+	}
+	c.deletedMap = export.DeletedInstances
+	if c.deletedMap == nil {
+		c.deletedMap = make(map[string]*model.DeletedInstance)
+	}
+	c.suspensionMap = export.Suspensions
+	if c.suspensionMap == nil {
+		c.suspensionMap = make(map[string]*model.Suspension)
+	}
+
+	if err := c.recordStores(); err != nil {
+		return err
+	}
+	return c.backups.Import(export.Backups)
+}
+
+// MigrateStore brings records written by older broker versions up to date
+// and writes every store file back in the current format. It returns what
+// it changed.
+func (c *Controller) MigrateStore(log *logger.Logger) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	changes := make([]string, 0)
+	for id, instance := range c.instanceMap {
+		if instance.Server == "" {
+			instance.Server = client.Address()
+			changes = append(changes, fmt.Sprintf("service instance %s: recorded server %s", id, instance.Server))
+		}
+		if url := dashboardUrl(id); instance.DashboardUrl != url {
+			instance.DashboardUrl = url
+			changes = append(changes, fmt.Sprintf("service instance %s: updated dashboard url", id))
+		}
+	}
+	for id, credential := range c.credentialMap {
+		if credential.Uri == "" {
+			credential.Uri = credential.BuildUri()
+			changes = append(changes, fmt.Sprintf("credential of service instance %s: built uri", id))
+		}
+	}
+
+	if err := c.recordStores(); err != nil {
+		return nil, err
+	}
+	log.Info("store migrated", "changes", len(changes))
+	return changes, nil
+}
+
+// Private instance methods
+
+// Must be called with c.lock held.
+func (c *Controller) recordStores() error {
+	for _, err := range []error{
+		utils.MarshalAndRecord(c.instanceMap, conf.DataPath, conf.ServiceInstancesFileName),
+		utils.MarshalAndRecord(c.credentialMap, conf.DataPath, conf.ServicdCredentialsFileName),
+		utils.MarshalAndRecord(c.bindingMap, conf.DataPath, conf.ServiceBindingsFileName),
+		utils.MarshalAndRecord(c.deletedMap, conf.DataPath, conf.DeletedInstancesFileName),
+		utils.MarshalAndRecord(c.suspensionMap, conf.DataPath, suspensionsFileName()),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
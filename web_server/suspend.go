@@ -0,0 +1,238 @@
+package web_server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/metrics"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	DEFAULT_SUSPENSIONS_FILE_NAME = "Suspensions.json"
+
+	INSTANCE_STATE_SUSPENDED = "suspended"
+)
+
+var (
+	ErrInstanceSuspended    = errors.New("service instance is suspended")
+	ErrInstanceNotSuspended = errors.New("service instance is not suspended")
+)
+
+// SuspendInstance locks the user of an instance out without touching its
+// data: the account is locked, or its privileges are revoked on servers that
+// can not lock accounts, and its open connections are killed. The grants of
+// the user are recorded first so that ResumeInstance can restore them.
+func (c *Controller) SuspendInstance(log *logger.Logger, instanceId, reason string) (*model.Suspension, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	instance, ok := c.instanceMap[instanceId]
+	if !ok {
+		return nil, ErrInstanceNotFound
+	}
+	if instance.Suspended {
+		return nil, ErrInstanceSuspended
+	}
+	credential, ok := c.credentialMap[instanceId]
+	if !ok {
+		return nil, errors.New("the service instance has no credential, resync it first")
+	}
+
+	suspension, err := suspendUser(log, credential.Username)
+	metrics.Operations.Inc("suspend", metrics.Outcome(err))
+	if err != nil {
+		return nil, err
+	}
+	suspension.InstanceId = instanceId
+	suspension.Reason = reason
+
+	c.suspensionMap[instanceId] = suspension
+	instance.Suspended = true
+	if err := c.recordSuspensions(); err != nil {
+		return nil, err
+	}
+	log.Info("service instance suspended", "instance_id", instanceId, "user", suspension.Username,
+		"method", suspension.Method, "killed_connections", suspension.KilledConnections)
+	c.recordUsage(log, model.USAGE_STATE_UPDATED, instance)
+
+	return suspension, nil
+}
+
+// ResumeInstance lets the user of a suspended instance connect again with
+// the privileges it had when the instance was suspended.
+func (c *Controller) ResumeInstance(log *logger.Logger, instanceId string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	instance, ok := c.instanceMap[instanceId]
+	if !ok {
+		return ErrInstanceNotFound
+	}
+	suspension, ok := c.suspensionMap[instanceId]
+	if !instance.Suspended || !ok {
+		return ErrInstanceNotSuspended
+	}
+
+	err := resumeUser(log, suspension)
+	metrics.Operations.Inc("resume", metrics.Outcome(err))
+	if err != nil {
+		return err
+	}
+
+	delete(c.suspensionMap, instanceId)
+	instance.Suspended = false
+	if err := c.recordSuspensions(); err != nil {
+		return err
+	}
+	log.Info("service instance resumed", "instance_id", instanceId, "user", suspension.Username)
+	c.recordUsage(log, model.USAGE_STATE_UPDATED, instance)
+
+	return nil
+}
+
+func (c *Controller) AdminSuspendInstance(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin suspend instance")
+
+	var request model.SuspendRequest
+	if r.ContentLength != 0 {
+		if err := utils.ProvisionDataFromRequest(r, &request); err != nil {
+			writeBrokerError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	suspension, err := c.SuspendInstance(log, utils.ExtractVarsFromRequest(r, "service_instance_guid"), request.Reason)
+	if err == ErrInstanceNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err == ErrInstanceSuspended {
+		writeBrokerError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Suspensions recorded by older brokers still carry password hashes.
+	response := *suspension
+	response.Grants = nil
+	utils.WriteResponse(w, http.StatusOK, response)
+}
+
+func (c *Controller) AdminResumeInstance(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin resume instance")
+
+	err := c.ResumeInstance(log, utils.ExtractVarsFromRequest(r, "service_instance_guid"))
+	if err == ErrInstanceNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err == ErrInstanceNotSuspended {
+		writeBrokerError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteResponse(w, http.StatusOK, "{}")
+}
+
+// Private instance methods
+
+// forgetSuspension drops the suspension record of an instance that is gone
+// for good. Must be called with c.lock held.
+func (c *Controller) forgetSuspension(instanceId string) error {
+	if _, ok := c.suspensionMap[instanceId]; !ok {
+		return nil
+	}
+
+	delete(c.suspensionMap, instanceId)
+	return utils.MarshalAndRecord(c.suspensionMap, conf.DataPath, suspensionsFileName())
+}
+
+// Must be called with c.lock held.
+func (c *Controller) recordSuspensions() error {
+	if err := utils.MarshalAndRecord(c.suspensionMap, conf.DataPath, suspensionsFileName()); err != nil {
+		return err
+	}
+	return utils.MarshalAndRecord(c.instanceMap, conf.DataPath, conf.ServiceInstancesFileName)
+}
+
+// Private methods
+
+func suspendUser(log *logger.Logger, user string) (*model.Suspension, error) {
+	grants, err := client.Grants(user)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not read the grants of user %s, message: %s", user, err.Error()))
+	}
+
+	suspension := &model.Suspension{
+		Username:    user,
+		Method:      model.SUSPEND_METHOD_ACCOUNT_LOCK,
+		Grants:      grants,
+		SuspendedAt: time.Now(),
+	}
+	err = client.LockUser(log, user)
+	if err == client.ErrAccountLockUnsupported {
+		suspension.Method = model.SUSPEND_METHOD_REVOKE
+		err = client.RevokePrivileges(log, user)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Locking and revoking only apply to new connections. The user is locked
+	// out already, so a failure here must not lose the suspension record.
+	suspension.KilledConnections, err = client.KillConnections(log, user)
+	if err != nil {
+		log.Warn("killing connections failed", "user", user, "err", err)
+	}
+	return suspension, nil
+}
+
+func resumeUser(log *logger.Logger, suspension *model.Suspension) error {
+	switch suspension.Method {
+	case model.SUSPEND_METHOD_ACCOUNT_LOCK:
+		return client.UnlockUser(log, suspension.Username)
+	case model.SUSPEND_METHOD_REVOKE:
+		// Start over from no privileges so that grants made meanwhile do not
+		// survive.
+		if err := client.RevokePrivileges(log, suspension.Username); err != nil {
+			return err
+		}
+		return client.ApplyGrants(log, suspension.Grants)
+	}
+	return errors.New(fmt.Sprintf("Unknown suspend method: %s", suspension.Method))
+}
+
+func suspensionsFileName() string {
+	if conf.SuspensionsFileName == "" {
+		return DEFAULT_SUSPENSIONS_FILE_NAME
+	}
+	return conf.SuspensionsFileName
+}
+
+func loadSuspensions() (map[string]*model.Suspension, error) {
+	var suspensionMap map[string]*model.Suspension
+
+	err := utils.ReadAndUnmarshal(&suspensionMap, conf.DataPath, suspensionsFileName())
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Warn("suspension data file does not exist", "file", suspensionsFileName())
+			suspensionMap = make(map[string]*model.Suspension)
+		} else {
+			return nil, errors.New(fmt.Sprintf("Could not load the suspensions, message: %s", err.Error()))
+		}
+	}
+
+	return suspensionMap, nil
+}
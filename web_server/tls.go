@@ -0,0 +1,219 @@
+package web_server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+)
+
+const (
+	CLIENT_AUTH_NONE     = "none"
+	CLIENT_AUTH_OPTIONAL = "optional"
+	CLIENT_AUTH_REQUIRE  = "require"
+
+	CIPHER_POLICY_DEFAULT = "default"
+	CIPHER_POLICY_MODERN  = "modern"
+
+	// The certificate files are checked for changes at most this often.
+	TLS_RELOAD_INTERVAL = 10 * time.Second
+)
+
+// TLS 1.3 needs Go 1.13, where it is on by default.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Cipher suites by policy. They only apply up to TLS 1.2, the TLS 1.3 suites
+// are not configurable. A nil list leaves the choice to Go.
+var cipherPolicies = map[string][]uint16{
+	CIPHER_POLICY_DEFAULT: nil,
+	CIPHER_POLICY_MODERN: {
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	},
+}
+
+// tlsReloader hands out a TLS configuration built from the certificate, key
+// and client CA files, and rebuilds it when one of the files changes so that
+// certificates can be rotated without restarting the broker. If a changed
+// file can not be loaded the previous configuration stays in use.
+type tlsReloader struct {
+	settings config.TLSConfig
+	base     *tls.Config
+
+	lock      sync.Mutex
+	current   *tls.Config
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+}
+
+func tlsEnabled() bool {
+	return conf.TLS.CertFile != "" || conf.TLS.KeyFile != ""
+}
+
+// newTLSConfig validates the TLS settings and returns the configuration of
+// the HTTPS server.
+func newTLSConfig(settings config.TLSConfig) (*tls.Config, error) {
+	if settings.CertFile == "" || settings.KeyFile == "" {
+		return nil, errors.New("Invalid tls settings: cert_file and key_file must both be set")
+	}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	if settings.MinVersion != "" {
+		version, ok := tlsVersions[settings.MinVersion]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Invalid tls min_version: %s", settings.MinVersion))
+		}
+		base.MinVersion = version
+	}
+
+	policy := settings.CipherPolicy
+	if policy == "" {
+		policy = CIPHER_POLICY_DEFAULT
+	}
+	ciphers, ok := cipherPolicies[policy]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Invalid tls cipher_policy: %s", settings.CipherPolicy))
+	}
+	base.CipherSuites = ciphers
+
+	switch settings.ClientAuth {
+	case CLIENT_AUTH_NONE, "":
+		base.ClientAuth = tls.NoClientCert
+	case CLIENT_AUTH_OPTIONAL:
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case CLIENT_AUTH_REQUIRE:
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.New(fmt.Sprintf("Invalid tls client_auth: %s", settings.ClientAuth))
+	}
+	if base.ClientAuth != tls.NoClientCert && settings.ClientCAFile == "" {
+		return nil, errors.New("Invalid tls settings: client_ca_file is required to verify client certificates")
+	}
+
+	reloader := &tlsReloader{settings: settings, base: base}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:         base.MinVersion,
+		GetConfigForClient: reloader.configForClient,
+	}, nil
+}
+
+// clientCertificateName returns the common name of the verified client
+// certificate of a request, if any.
+func clientCertificateName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+// Private instance methods
+
+func (t *tlsReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if time.Since(t.checkedAt) >= TLS_RELOAD_INTERVAL {
+		t.checkedAt = time.Now()
+		if t.changed() {
+			if err := t.load(); err != nil {
+				logger.Error("reloading tls certificates failed, keeping the previous ones", "err", err)
+			} else {
+				logger.Info("tls certificates reloaded", "cert_file", t.settings.CertFile)
+			}
+		}
+	}
+
+	return t.current, nil
+}
+
+func (t *tlsReloader) reload() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.checkedAt = time.Now()
+	return t.load()
+}
+
+// Must be called with t.lock held.
+func (t *tlsReloader) load() error {
+	modTimes, err := t.statFiles()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(t.settings.CertFile, t.settings.KeyFile)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Could not load the tls certificate, message: %s", err.Error()))
+	}
+
+	current := t.base.Clone()
+	current.Certificates = []tls.Certificate{certificate}
+
+	if t.settings.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(t.settings.ClientCAFile)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Could not load the tls client CAs, message: %s", err.Error()))
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New(fmt.Sprintf("Could not load the tls client CAs, message: no certificate found in %s", t.settings.ClientCAFile))
+		}
+		current.ClientCAs = pool
+	}
+
+	t.current = current
+	t.modTimes = modTimes
+	return nil
+}
+
+// Must be called with t.lock held.
+func (t *tlsReloader) changed() bool {
+	modTimes, err := t.statFiles()
+	if err != nil {
+		// Rotation tools may replace the files one at a time, try again later.
+		return false
+	}
+
+	for path, modTime := range modTimes {
+		if !modTime.Equal(t.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tlsReloader) statFiles() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	for _, path := range []string{t.settings.CertFile, t.settings.KeyFile, t.settings.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[path] = info.ModTime()
+	}
+	return modTimes, nil
+}
@@ -0,0 +1,217 @@
+package web_server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/client"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/usage"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	DEFAULT_USAGE_LOG_FILE_NAME   = "UsageEvents.jsonl"
+	DEFAULT_USAGE_SAMPLE_INTERVAL = time.Hour
+
+	DEFAULT_USAGE_RESULTS_PER_PAGE = 50
+	MAX_USAGE_RESULTS_PER_PAGE     = 1000
+)
+
+// AdminListUsageEvents returns a page of usage events, oldest first. A
+// consumer starts without after_sequence and follows next_url, or passes the
+// sequence number of the last event it has processed as after_sequence.
+func (c *Controller) AdminListUsageEvents(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	log.Debug("admin list usage events")
+
+	query := r.URL.Query()
+	perPage := DEFAULT_USAGE_RESULTS_PER_PAGE
+	if value := query.Get("results_per_page"); value != "" {
+		var err error
+		if perPage, err = strconv.Atoi(value); err != nil || perPage <= 0 || perPage > MAX_USAGE_RESULTS_PER_PAGE {
+			writeBrokerError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid results_per_page: %s, it must be between 1 and %d", value, MAX_USAGE_RESULTS_PER_PAGE)))
+			return
+		}
+	}
+
+	var after int64
+	if value := query.Get("after_sequence"); value != "" {
+		var err error
+		if after, err = strconv.ParseInt(value, 10, 64); err != nil {
+			writeBrokerError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid after_sequence: %s", value)))
+			return
+		}
+	}
+
+	events, total, err := c.usage.After(after, perPage)
+	if err == usage.ErrUnknownSequence {
+		writeBrokerError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid after_sequence: %d", after)))
+		return
+	} else if err != nil {
+		writeBrokerError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := &model.UsageEventPage{TotalResults: total, Resources: events}
+	if page.Resources == nil {
+		page.Resources = []*model.UsageEvent{}
+	}
+	if len(events) > 0 && total > len(events) {
+		next := url.Values{}
+		next.Set("after_sequence", strconv.FormatInt(events[len(events)-1].Sequence, 10))
+		next.Set("results_per_page", strconv.Itoa(perPage))
+		page.NextUrl = r.URL.Path + "?" + next.Encode()
+	}
+
+	utils.WriteResponse(w, http.StatusOK, page)
+}
+
+// Private instance methods
+
+// recordUsage appends a usage event for instance to the usage log. Failures
+// are logged, an operation that has already been carried out can not be
+// undone for want of a usage event.
+func (c *Controller) recordUsage(log *logger.Logger, state string, instance *model.ServiceInstance) {
+	catalog, err := c.loadCatalog()
+	if err != nil {
+		log.Warn("loading the catalog for a usage event failed", "err", err)
+	}
+
+	event := usageEvent(catalog, state, instance)
+	if err := c.usage.Append(event); err != nil {
+		log.Error("recording usage event failed", "state", state, "instance_id", instance.Id, "err", err)
+	}
+}
+
+func (c *Controller) startUsageSampler(interval time.Duration) {
+	c.usageStop = make(chan struct{})
+	c.usageDone = make(chan struct{})
+
+	go func() {
+		defer close(c.usageDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.usageStop:
+				return
+			case <-ticker.C:
+				c.sampleUsage()
+			}
+		}
+	}()
+}
+
+func (c *Controller) stopUsageSampler() {
+	if c.usageStop == nil {
+		return
+	}
+
+	close(c.usageStop)
+	<-c.usageDone
+}
+
+// sampleUsage records the size of every instance's database.
+func (c *Controller) sampleUsage() {
+	log := logger.New("job", "usage_sample")
+
+	sizes, err := client.DatabaseSizes()
+	if err != nil {
+		log.Error("reading database sizes failed", "err", err)
+		return
+	}
+	catalog, err := c.loadCatalog()
+	if err != nil {
+		log.Warn("loading the catalog for usage samples failed", "err", err)
+	}
+
+	instances := c.listInstances()
+	for _, instance := range instances {
+		event := usageEvent(catalog, model.USAGE_STATE_SAMPLE, instance)
+		size := sizes[instance.InternalId]
+		event.SizeBytes = &size
+		if err := c.usage.Append(event); err != nil {
+			log.Error("recording usage sample failed", "instance_id", instance.Id, "err", err)
+			return
+		}
+	}
+	log.Debug("usage sampled", "instances", len(instances))
+}
+
+// Private methods
+
+// usageEvent describes instance in its current state. catalog may be nil,
+// the plan details are left out then.
+func usageEvent(catalog *model.Catalog, state string, instance *model.ServiceInstance) *model.UsageEvent {
+	event := &model.UsageEvent{
+		State:               state,
+		ServiceInstanceGuid: instance.Id,
+		ServiceGuid:         instance.ServiceId,
+		ServicePlanGuid:     instance.PlanId,
+		OrganizationGuid:    instance.OrganizationGuid,
+		SpaceGuid:           instance.SpaceGuid,
+		Suspended:           instance.Suspended,
+	}
+	if instance.Context != nil && instance.Context.Platform == model.PLATFORM_KUBERNETES {
+		event.Namespace = instance.Context.Namespace
+	}
+
+	if plan := catalogPlan(catalog, instance.ServiceId, instance.PlanId); plan != nil {
+		event.ServicePlanName = plan.Name
+		event.PlanFree = plan.Free
+		if metadata, ok := plan.Metadata.(map[string]interface{}); ok {
+			event.PlanCost = metadata["cost"]
+		}
+	}
+	return event
+}
+
+func catalogPlan(catalog *model.Catalog, serviceId, planId string) *model.ServicePlan {
+	if catalog == nil {
+		return nil
+	}
+	for _, service := range catalog.Services {
+		if service.Id != serviceId {
+			continue
+		}
+		for i := range service.Plans {
+			if service.Plans[i].Id == planId {
+				return &service.Plans[i]
+			}
+		}
+	}
+	return nil
+}
+
+func usageSampleInterval() (time.Duration, error) {
+	if conf.UsageSampleInterval == "" {
+		return DEFAULT_USAGE_SAMPLE_INTERVAL, nil
+	}
+
+	interval, err := time.ParseDuration(conf.UsageSampleInterval)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid usage_sample_interval: %s", err.Error()))
+	}
+	if interval < time.Minute {
+		return 0, errors.New(fmt.Sprintf("Invalid usage_sample_interval: %s, it must be at least a minute", conf.UsageSampleInterval))
+	}
+	return interval, nil
+}
+
+func loadUsageLog() (*usage.Log, error) {
+	fileName := conf.UsageLogFileName
+	if fileName == "" {
+		fileName = DEFAULT_USAGE_LOG_FILE_NAME
+	}
+
+	return usage.Open(filepath.Join(conf.DataPath, fileName))
+}
@@ -0,0 +1,94 @@
+package web_server
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/webhook"
+)
+
+const DEFAULT_WEBHOOK_DEAD_LETTER_FILE_NAME = "WebhookDeadLetters.jsonl"
+
+// Routes whose outcome is posted to the webhooks, by route name, with the
+// event they are reported as when they succeed.
+var webhookRoutes = map[string]string{
+	"provision":   model.WEBHOOK_EVENT_PROVISION,
+	"deprovision": model.WEBHOOK_EVENT_DEPROVISION,
+	"bind":        model.WEBHOOK_EVENT_BIND,
+	"unbind":      model.WEBHOOK_EVENT_UNBIND,
+}
+
+// webhookHandler notifies the webhooks once next has handled a request to
+// one of the routes in webhookRoutes. Accepted asynchronous provisions are
+// reported when they finish instead, and requests answered with 410 Gone
+// changed nothing.
+func webhookHandler(router *mux.Router, notifier *webhook.Notifier, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+		if !router.Match(r, &match) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		operation := match.Route.GetName()
+		eventName, ok := webhookRoutes[operation]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &auditRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		if recorder.status == http.StatusAccepted || recorder.status == http.StatusGone {
+			return
+		}
+
+		event := &model.WebhookEvent{
+			Event:      eventName,
+			Operation:  operation,
+			RequestId:  requestIdFromRequest(r),
+			InstanceId: match.Vars["service_instance_guid"],
+			BindingId:  match.Vars["service_binding_guid"],
+			Status:     recorder.status,
+		}
+		if recorder.status >= 400 {
+			event.Event = model.WEBHOOK_EVENT_FAILURE
+			event.Error = errorDescription(recorder.body.Bytes())
+		}
+		notifier.Notify(event)
+	})
+}
+
+// Private instance methods
+
+// notifyAsyncProvision reports the outcome of a provision that finished in
+// the background.
+func (c *Controller) notifyAsyncProvision(instanceId string, err error) {
+	event := &model.WebhookEvent{
+		Event:      model.WEBHOOK_EVENT_PROVISION,
+		Operation:  model.WEBHOOK_EVENT_PROVISION,
+		InstanceId: instanceId,
+	}
+	if err != nil {
+		event.Event = model.WEBHOOK_EVENT_FAILURE
+		event.Error = logger.Redact(err.Error())
+	}
+	c.webhooks.Notify(event)
+}
+
+// Private methods
+
+func loadWebhookNotifier() (*webhook.Notifier, error) {
+	fileName := conf.WebhookDeadLetterFileName
+	if fileName == "" {
+		fileName = DEFAULT_WEBHOOK_DEAD_LETTER_FILE_NAME
+	}
+
+	return webhook.NewNotifier(conf.Webhooks, filepath.Join(conf.DataPath, fileName))
+}
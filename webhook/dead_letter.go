@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+// deadLetterFile appends undeliverable events to a file, one JSON object per
+// line, for an operator to inspect or replay.
+type deadLetterFile struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+func openDeadLetterFile(path string) (*deadLetterFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not open the webhook dead letter file, message: %s", err.Error()))
+	}
+
+	return &deadLetterFile{file: file}, nil
+}
+
+func (d *deadLetterFile) Append(letter *model.WebhookDeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if _, err := d.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return d.file.Sync()
+}
+
+func (d *deadLetterFile) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.file.Close()
+}
@@ -0,0 +1,316 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/logger"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/metrics"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/utils"
+)
+
+const (
+	DEFAULT_MAX_ATTEMPTS = 5
+	DEFAULT_TIMEOUT      = 10 * time.Second
+
+	// The wait before the second attempt, doubled for every further one.
+	INITIAL_BACKOFF = time.Second
+	MAX_BACKOFF     = 5 * time.Minute
+
+	// Events waiting for an endpoint beyond this many go to the dead letter
+	// file right away.
+	QUEUE_SIZE = 1000
+
+	// The signature is the hex encoded HMAC-SHA256 of the timestamp, a dot
+	// and the body, keyed with the endpoint's secret.
+	SIGNATURE_HEADER = "X-Broker-Signature"
+	TIMESTAMP_HEADER = "X-Broker-Timestamp"
+	EVENT_HEADER     = "X-Broker-Event"
+	DELIVERY_HEADER  = "X-Broker-Delivery"
+)
+
+var validEvents = map[string]bool{
+	model.WEBHOOK_EVENT_PROVISION:   true,
+	model.WEBHOOK_EVENT_DEPROVISION: true,
+	model.WEBHOOK_EVENT_BIND:        true,
+	model.WEBHOOK_EVENT_UNBIND:      true,
+	model.WEBHOOK_EVENT_FAILURE:     true,
+}
+
+type endpoint struct {
+	// url is the address of the endpoint without user info, for logs and
+	// dead letters.
+	url         string
+	target      string
+	secret      string
+	events      map[string]bool
+	maxAttempts int
+	backoff     time.Duration
+	client      *http.Client
+	queue       chan *model.WebhookEvent
+}
+
+// Notifier posts events to the configured webhook endpoints in the
+// background. Each endpoint has its own queue, so a slow or failing
+// endpoint does not hold up the others. Events that can not be delivered are
+// written to the dead letter file.
+type Notifier struct {
+	endpoints   []*endpoint
+	deadLetters *deadLetterFile
+
+	// lock keeps Notify from queueing events once Stop has begun, nothing
+	// would deliver them.
+	lock     sync.RWMutex
+	stopped  bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     sync.WaitGroup
+}
+
+func NewNotifier(configs []config.WebhookConfig, deadLetterPath string) (*Notifier, error) {
+	n := &Notifier{stop: make(chan struct{})}
+	for i, c := range configs {
+		e, err := newEndpoint(c)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid webhook #%d: %s", i, err.Error()))
+		}
+		n.endpoints = append(n.endpoints, e)
+	}
+
+	if len(n.endpoints) > 0 {
+		var err error
+		if n.deadLetters, err = openDeadLetterFile(deadLetterPath); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (n *Notifier) Start() {
+	if len(n.endpoints) == 0 {
+		return
+	}
+
+	for _, e := range n.endpoints {
+		n.done.Add(1)
+		go n.loop(e)
+	}
+}
+
+// Stop waits for the delivery attempts in progress and writes the events
+// still waiting, or waiting for a retry, to the dead letter file. Events
+// notified afterwards go to the dead letter file right away. Stop may be
+// called more than once.
+func (n *Notifier) Stop() {
+	n.stopOnce.Do(func() {
+		n.lock.Lock()
+		n.stopped = true
+		close(n.stop)
+		n.lock.Unlock()
+
+		n.done.Wait()
+		for _, e := range n.endpoints {
+			for len(e.queue) > 0 {
+				n.deadLetter(e, <-e.queue, 0, errors.New("broker shut down before delivery"))
+			}
+		}
+	})
+}
+
+// Close closes the dead letter file, once nothing notifies events anymore.
+func (n *Notifier) Close() error {
+	if n.deadLetters == nil {
+		return nil
+	}
+	return n.deadLetters.Close()
+}
+
+// Notify fills in the id and time of event if they are missing and queues
+// it for the endpoints that want it.
+func (n *Notifier) Notify(event *model.WebhookEvent) {
+	if event.Id == "" {
+		event.Id = utils.GetGuid()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	for _, e := range n.endpoints {
+		if len(e.events) > 0 && !e.events[event.Event] {
+			continue
+		}
+		if n.stopped {
+			n.deadLetter(e, event, 0, errors.New("broker shut down before delivery"))
+			continue
+		}
+		select {
+		case e.queue <- event:
+		default:
+			n.deadLetter(e, event, 0, errors.New("queue full"))
+		}
+	}
+}
+
+// Sign returns the signature of a payload sent at timestamp, as the
+// receiver should compute it to verify a delivery.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Private instance methods
+
+func (n *Notifier) loop(e *endpoint) {
+	defer n.done.Done()
+
+	for {
+		select {
+		case <-n.stop:
+			// Stop dead letters the events left in the queue.
+			return
+		case event := <-e.queue:
+			n.deliver(e, event)
+		}
+	}
+}
+
+// deliver posts event to e until it is accepted or the attempts are used up.
+func (n *Notifier) deliver(e *endpoint, event *model.WebhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		n.deadLetter(e, event, 0, err)
+		return
+	}
+
+	backoff := e.backoff
+	for attempt := 1; ; attempt++ {
+		err = e.post(event, body)
+		if err == nil {
+			metrics.Operations.Inc("webhook", metrics.OUTCOME_SUCCEEDED)
+			logger.Debug("webhook delivered", "url", e.url, "event", event.Event, "event_id", event.Id, "attempt", attempt)
+			return
+		}
+		logger.Warn("webhook delivery failed", "url", e.url, "event", event.Event, "event_id", event.Id, "attempt", attempt, "err", err)
+
+		if attempt >= e.maxAttempts {
+			n.deadLetter(e, event, attempt, err)
+			return
+		}
+
+		select {
+		case <-n.stop:
+			n.deadLetter(e, event, attempt, errors.New(fmt.Sprintf("%s, broker shut down before the next attempt", err.Error())))
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > MAX_BACKOFF {
+			backoff = MAX_BACKOFF
+		}
+	}
+}
+
+func (n *Notifier) deadLetter(e *endpoint, event *model.WebhookEvent, attempts int, cause error) {
+	metrics.Operations.Inc("webhook", metrics.OUTCOME_FAILED)
+	logger.Error("webhook event dead lettered", "url", e.url, "event", event.Event, "event_id", event.Id, "attempts", attempts, "err", cause)
+
+	letter := &model.WebhookDeadLetter{
+		Url:      e.url,
+		Event:    event,
+		Attempts: attempts,
+		Error:    cause.Error(),
+		FailedAt: time.Now().UTC(),
+	}
+	if err := n.deadLetters.Append(letter); err != nil {
+		logger.Error("recording webhook dead letter failed", "url", e.url, "event_id", event.Id, "err", err)
+	}
+}
+
+func (e *endpoint) post(event *model.WebhookEvent, body []byte) error {
+	request, err := http.NewRequest("POST", e.target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EVENT_HEADER, event.Event)
+	request.Header.Set(DELIVERY_HEADER, event.Id)
+	request.Header.Set(TIMESTAMP_HEADER, timestamp)
+	request.Header.Set(SIGNATURE_HEADER, "sha256="+Sign(e.secret, timestamp, body))
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("endpoint answered %s", response.Status))
+	}
+	return nil
+}
+
+// Private methods
+
+func newEndpoint(c config.WebhookConfig) (*endpoint, error) {
+	target, err := url.Parse(c.Url)
+	if err != nil {
+		return nil, err
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.New("url is not an http or https url")
+	}
+	if c.Secret == "" {
+		return nil, errors.New("secret is empty, payloads could not be signed")
+	}
+
+	e := &endpoint{
+		url:         target.Scheme + "://" + target.Host + target.Path,
+		target:      c.Url,
+		secret:      c.Secret,
+		events:      make(map[string]bool),
+		maxAttempts: DEFAULT_MAX_ATTEMPTS,
+		backoff:     INITIAL_BACKOFF,
+		client:      &http.Client{Timeout: DEFAULT_TIMEOUT},
+		queue:       make(chan *model.WebhookEvent, QUEUE_SIZE),
+	}
+	for _, event := range c.Events {
+		if !validEvents[event] {
+			return nil, errors.New(fmt.Sprintf("unknown event %s", event))
+		}
+		e.events[event] = true
+	}
+	if c.MaxAttempts < 0 {
+		return nil, errors.New("max_attempts is negative")
+	} else if c.MaxAttempts > 0 {
+		e.maxAttempts = c.MaxAttempts
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("timeout: %s", err.Error()))
+		}
+		e.client.Timeout = timeout
+	}
+	return e, nil
+}
@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/config"
+	"github.com/asiainfoLDP/datafactory-servicebroker-mysql/model"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret, timestamp, body string
+		signature               string
+	}{
+		{"secret", "1700000000", `{"event":"provision"}`, "34457a8b0df37b1fa2cf0295b7c36bc4a61c6d6605b04b455c592e6dfffbdd8f"},
+		{"", "0", "", "b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+	}
+
+	for _, test := range tests {
+		if signature := Sign(test.secret, test.timestamp, []byte(test.body)); signature != test.signature {
+			t.Errorf("Sign(%q, %q, %q) = %s, want %s", test.secret, test.timestamp, test.body, signature, test.signature)
+		}
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	endpoint := newTestEndpoint(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	defer endpoint.Close()
+	notifier, deadLetterPath, cleanup := newTestNotifier(t, config.WebhookConfig{Url: endpoint.URL, Secret: "secret", MaxAttempts: 5})
+	defer cleanup()
+
+	notifier.Start()
+	notifier.Notify(&model.WebhookEvent{Event: model.WEBHOOK_EVENT_PROVISION, InstanceId: "instance"})
+	endpoint.wait(t, 3)
+	notifier.Stop()
+
+	for i, request := range endpoint.requests() {
+		if request.signature != "sha256="+Sign("secret", request.timestamp, request.body) {
+			t.Errorf("attempt %d has signature %s", i+1, request.signature)
+		}
+		if request.event != model.WEBHOOK_EVENT_PROVISION {
+			t.Errorf("attempt %d has event %s", i+1, request.event)
+		}
+	}
+	if letters := readDeadLetters(t, deadLetterPath); len(letters) != 0 {
+		t.Errorf("delivered event was dead lettered: %+v", letters)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	endpoint := newTestEndpoint(t, http.StatusInternalServerError)
+	defer endpoint.Close()
+	notifier, deadLetterPath, cleanup := newTestNotifier(t, config.WebhookConfig{
+		Url:         endpoint.URL,
+		Secret:      "secret",
+		Events:      []string{model.WEBHOOK_EVENT_PROVISION, model.WEBHOOK_EVENT_BIND},
+		MaxAttempts: 2,
+	})
+	defer cleanup()
+
+	notifier.Start()
+	notifier.Notify(&model.WebhookEvent{Id: "failing", Event: model.WEBHOOK_EVENT_PROVISION})
+	// Not one of the events of the endpoint.
+	notifier.Notify(&model.WebhookEvent{Id: "ignored", Event: model.WEBHOOK_EVENT_UNBIND})
+	endpoint.wait(t, 2)
+	notifier.Stop()
+	notifier.Stop()
+	notifier.Notify(&model.WebhookEvent{Id: "late", Event: model.WEBHOOK_EVENT_BIND})
+	if err := notifier.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	letters := readDeadLetters(t, deadLetterPath)
+	if len(letters) != 2 {
+		t.Fatalf("%d dead letters, want 2: %+v", len(letters), letters)
+	}
+	if letters[0].Event.Id != "failing" || letters[0].Attempts != 2 || !strings.Contains(letters[0].Error, "500") {
+		t.Errorf("first dead letter is %+v", letters[0])
+	}
+	if letters[1].Event.Id != "late" || letters[1].Attempts != 0 {
+		t.Errorf("event notified after stop is dead lettered as %+v", letters[1])
+	}
+	if letters[0].Url != endpoint.URL {
+		t.Errorf("dead letter has url %s, want %s", letters[0].Url, endpoint.URL)
+	}
+}
+
+func TestStopDeadLettersQueuedEvents(t *testing.T) {
+	endpoint := newTestEndpoint(t, http.StatusOK)
+	defer endpoint.Close()
+	notifier, deadLetterPath, cleanup := newTestNotifier(t, config.WebhookConfig{Url: endpoint.URL, Secret: "secret"})
+	defer cleanup()
+
+	// Without Start nothing delivers the events.
+	notifier.Notify(&model.WebhookEvent{Id: "queued", Event: model.WEBHOOK_EVENT_DEPROVISION})
+	notifier.Stop()
+
+	letters := readDeadLetters(t, deadLetterPath)
+	if len(letters) != 1 || letters[0].Event.Id != "queued" {
+		t.Errorf("dead letters are %+v, want the queued event", letters)
+	}
+}
+
+type testRequest struct {
+	event, timestamp, signature string
+	body                        []byte
+}
+
+// testEndpoint answers the webhook requests it gets with the given statuses,
+// repeating the last one.
+type testEndpoint struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	statuses []int
+	received []testRequest
+	arrived  chan struct{}
+}
+
+func newTestEndpoint(t *testing.T, statuses ...int) *testEndpoint {
+	e := &testEndpoint{statuses: statuses, arrived: make(chan struct{}, 100)}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		e.lock.Lock()
+		status := e.statuses[len(e.statuses)-1]
+		if len(e.received) < len(e.statuses) {
+			status = e.statuses[len(e.received)]
+		}
+		e.received = append(e.received, testRequest{
+			event:     r.Header.Get(EVENT_HEADER),
+			timestamp: r.Header.Get(TIMESTAMP_HEADER),
+			signature: r.Header.Get(SIGNATURE_HEADER),
+			body:      body,
+		})
+		e.lock.Unlock()
+
+		w.WriteHeader(status)
+		e.arrived <- struct{}{}
+	}))
+	return e
+}
+
+// wait waits until the endpoint has answered count requests.
+func (e *testEndpoint) wait(t *testing.T, count int) {
+	for i := 0; i < count; i++ {
+		select {
+		case <-e.arrived:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("endpoint got %d requests, want %d", i, count)
+		}
+	}
+}
+
+func (e *testEndpoint) requests() []testRequest {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return append([]testRequest(nil), e.received...)
+}
+
+// newTestNotifier returns a notifier for the endpoint that retries without
+// waiting, the path of its dead letter file and a function removing it.
+func newTestNotifier(t *testing.T, c config.WebhookConfig) (*Notifier, string, func()) {
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, "WebhookDeadLetters.jsonl")
+	notifier, err := NewNotifier([]config.WebhookConfig{c}, path)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	for _, e := range notifier.endpoints {
+		e.backoff = time.Millisecond
+	}
+	return notifier, path, cleanup
+}
+
+func readDeadLetters(t *testing.T, path string) []*model.WebhookDeadLetter {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var letters []*model.WebhookDeadLetter
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var letter model.WebhookDeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, &letter)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return letters
+}